@@ -0,0 +1,183 @@
+package buffers
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// captureGapWait is how far the live edge may go past the end of a capture's
+// window while segments inside it are still missing. Segments are downloaded
+// concurrently and can be inserted out of order, so a later one arriving first
+// does not mean the earlier one is lost.
+const captureGapWait = 10 * time.Second
+
+// ClipCapture collects the segments around a moment of the stream. Its
+// segments are retained, so eviction from the MediaBuffer goes on as usual
+// without losing them.
+type ClipCapture struct {
+	mb       *MediaBuffer
+	from, to time.Time
+	at       time.Time
+
+	mu       sync.Mutex
+	segments []*MediaData
+	// lead and tail are the nearest segments seen before and after the
+	// window, they tell whether the window's first or last segment is missing
+	lead, tail *MediaData
+	done       chan struct{}
+}
+
+// Capture pins the preRoll of video before t that is already buffered, keeps
+// collecting segments until postRoll after t was inserted without any missing
+// in between, and then completes with exactly that window. Segments still
+// missing once the live edge went captureGapWait past the window are given up
+// on and left as gaps of the clip.
+func (mb *MediaBuffer) Capture(t time.Time, preRoll, postRoll time.Duration) *ClipCapture {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	cc := &ClipCapture{
+		mb:       mb,
+		from:     t.Add(-preRoll),
+		to:       t.Add(postRoll),
+		at:       t,
+		segments: make([]*MediaData, 0),
+		done:     make(chan struct{}),
+	}
+
+	for _, segment := range mb.segments.Items() {
+		cc.add(segment)
+	}
+
+	if !cc.completed(mb.liveEdge) {
+		mb.captures = append(mb.captures, cc)
+	}
+
+	return cc
+}
+
+// Done is closed once the whole window was collected.
+func (cc *ClipCapture) Done() <-chan struct{} {
+	return cc.done
+}
+
+// Wait returns the clip once the whole window was collected. When ctx is done
+// first it returns what was collected so far along with the context's error.
+// Either way the clip must be released.
+func (cc *ClipCapture) Wait(ctx context.Context) (*Clip, error) {
+	select {
+	case <-cc.done:
+		return cc.clip(), nil
+	case <-ctx.Done():
+		cc.mb.stopCapture(cc)
+		return cc.clip(), ctx.Err()
+	}
+}
+
+func (cc *ClipCapture) clip() *Clip {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	return NewClip(slices.Clone(cc.segments), cc.at)
+}
+
+// add retains segment when it falls into the window. It is called with the
+// buffer locked.
+func (cc *ClipCapture) add(segment *MediaData) {
+	if segment.ProgramDateTime.IsZero() {
+		return
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	// The neighbours are only compared, so they are not retained
+	switch {
+	case !segment.end().After(cc.from):
+		if cc.lead == nil || cc.lead.before(segment) {
+			cc.lead = segment
+		}
+		return
+	case !segment.ProgramDateTime.Before(cc.to):
+		if cc.tail == nil || segment.before(cc.tail) {
+			cc.tail = segment
+		}
+		return
+	}
+
+	pos, found := slices.BinarySearchFunc(cc.segments, segment, func(a, b *MediaData) int {
+		switch {
+		case a.before(b):
+			return -1
+		case b.before(a):
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	if found {
+		return
+	}
+
+	cc.segments = slices.Insert(cc.segments, pos, segment.retain())
+}
+
+// completed reports whether the live edge, the end of the newest segment,
+// went past the end of the window with no segment missing inside it, or went
+// captureGapWait past it, closing done when it did. It is called with the
+// buffer locked.
+func (cc *ClipCapture) completed(liveEdge time.Time) bool {
+	if liveEdge.Before(cc.to) {
+		return false
+	}
+
+	if !cc.contiguous() && liveEdge.Before(cc.to.Add(captureGapWait)) {
+		return false
+	}
+
+	close(cc.done)
+	return true
+}
+
+// contiguous reports whether no segment is missing between the neighbours of
+// the window.
+func (cc *ClipCapture) contiguous() bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	segments := make([]*MediaData, 0, len(cc.segments)+2)
+	if cc.lead != nil {
+		segments = append(segments, cc.lead)
+	}
+	segments = append(segments, cc.segments...)
+	if cc.tail != nil {
+		segments = append(segments, cc.tail)
+	}
+
+	return len(SegmentGaps(segments)) == 0
+}
+
+// notifyCaptures hands an inserted segment to the pending captures. It is
+// called with the buffer locked.
+func (mb *MediaBuffer) notifyCaptures(segment *MediaData) {
+	if segment.end().After(mb.liveEdge) {
+		mb.liveEdge = segment.end()
+	}
+
+	mb.captures = slices.DeleteFunc(mb.captures, func(cc *ClipCapture) bool {
+		cc.add(segment)
+		return cc.completed(mb.liveEdge)
+	})
+}
+
+func (mb *MediaBuffer) stopCapture(cc *ClipCapture) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.captures = slices.DeleteFunc(mb.captures, func(other *ClipCapture) bool {
+		return other == cc
+	})
+}
@@ -0,0 +1,138 @@
+package buffers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMediaBufferCapture(t *testing.T) {
+	start := time.Date(2025, 5, 11, 13, 40, 0, 0, time.UTC)
+	pool := NewBytePool()
+	mb := NewMediaBuffer(6)
+
+	insert := func(i int) {
+		mb.Insert(&MediaData{
+			SeqId:           uint64(i),
+			Data:            pool.Get(),
+			Duration:        2,
+			ProgramDateTime: start.Add(time.Duration(i) * 2 * time.Second),
+		})
+	}
+
+	for i := 0; i < 4; i++ {
+		insert(i)
+	}
+
+	ban := start.Add(7 * time.Second)
+	capture := mb.Capture(ban, 4*time.Second, 4*time.Second)
+
+	insert(4)
+	select {
+	case <-capture.Done():
+		t.Fatal("capture completed before the post-roll was buffered")
+	default:
+	}
+
+	// Evicts the pre-roll from the buffer, but the capture keeps it
+	insert(5)
+	insert(6)
+	assert.False(t, mb.Contains(0, 1))
+
+	clip, err := capture.Wait(context.Background())
+	assert.NoError(t, err)
+	defer clip.Release()
+
+	seqIds := make([]uint64, len(clip.Segments))
+	for i, segment := range clip.Segments {
+		seqIds[i] = segment.SeqId
+		assert.Positive(t, segment.Data.refs.Load())
+	}
+
+	assert.Equal(t, []uint64{1, 2, 3, 4, 5}, seqIds)
+	assert.Equal(t, start.Add(2*time.Second), clip.Start)
+	assert.Equal(t, 5*time.Second, clip.Offset)
+}
+
+func TestMediaBufferCaptureTimeout(t *testing.T) {
+	start := time.Date(2025, 5, 11, 13, 40, 0, 0, time.UTC)
+	mb := NewMediaBuffer(90)
+	mb.Insert(&MediaData{SeqId: 1, Duration: 2, ProgramDateTime: start})
+
+	capture := mb.Capture(start.Add(time.Second), 10*time.Second, 10*time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	clip, err := capture.Wait(ctx)
+	defer clip.Release()
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Len(t, clip.Segments, 1)
+	assert.Empty(t, mb.captures)
+}
+
+func TestMediaBufferCaptureOutOfOrder(t *testing.T) {
+	start := time.Date(2025, 5, 11, 13, 40, 0, 0, time.UTC)
+
+	insert := func(mb *MediaBuffer, i int) {
+		mb.Insert(&MediaData{SeqId: uint64(i), Duration: 2, ProgramDateTime: start.Add(time.Duration(i) * 2 * time.Second)})
+	}
+
+	pending := func(capture *ClipCapture) bool {
+		select {
+		case <-capture.Done():
+			return false
+		default:
+			return true
+		}
+	}
+
+	tests := []struct {
+		name string
+		// inserted after 0 and 1, the capture covers 2 to 4
+		inserts []int
+		pending bool
+	}{
+		{name: "in order", inserts: []int{2, 3, 4, 5}, pending: false},
+		{name: "last one late", inserts: []int{2, 3, 5}, pending: true},
+		{name: "last one arrived", inserts: []int{2, 3, 5, 4}, pending: false},
+		{name: "middle one late", inserts: []int{2, 4, 5, 6}, pending: true},
+		{name: "first one late", inserts: []int{3, 4, 5}, pending: true},
+		{name: "given up on", inserts: []int{2, 4, 5, 6, 7, 8, 9, 10}, pending: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mb := NewMediaBuffer(90)
+			insert(mb, 0)
+			insert(mb, 1)
+
+			capture := mb.Capture(start.Add(7*time.Second), 3*time.Second, 3*time.Second)
+			for _, i := range tt.inserts {
+				insert(mb, i)
+			}
+
+			assert.Equal(t, tt.pending, pending(capture))
+		})
+	}
+}
+
+func TestMediaBufferCaptureCarriesOverClear(t *testing.T) {
+	start := time.Date(2025, 5, 11, 13, 40, 0, 0, time.UTC)
+	mb := NewMediaBuffer(90)
+	mb.Insert(&MediaData{SeqId: 1, Duration: 2, ProgramDateTime: start})
+
+	capture := mb.Capture(start.Add(time.Second), time.Second, 3*time.Second)
+	mb.Clear()
+
+	// After a reconnect the media sequence starts over
+	mb.Insert(&MediaData{Epoch: 1, SeqId: 1, Duration: 2, ProgramDateTime: start.Add(2 * time.Second)})
+	mb.Insert(&MediaData{Epoch: 1, SeqId: 2, Duration: 2, ProgramDateTime: start.Add(4 * time.Second)})
+
+	clip, err := capture.Wait(context.Background())
+	defer clip.Release()
+	assert.NoError(t, err)
+	assert.Len(t, clip.Segments, 2)
+}
@@ -0,0 +1,254 @@
+package buffers
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBaselineWindow = 10 * time.Minute
+	// maxFrequencies is how many emotes and phrases the stats list
+	maxFrequencies = 5
+)
+
+// ChatActivity keeps per-second chat statistics fed with the same messages as
+// MessagesBuffer, and a moving baseline of the message rate to tell spikes
+// from the usual activity. It is safe for concurrent use.
+type ChatActivity struct {
+	mu sync.Mutex
+
+	// buckets hold the last len(buckets) seconds, by Unix second modulo
+	// their count
+	buckets []*activityBucket
+	latest  int64
+
+	// baseline is an EWMA of the messages per second with a time constant
+	// of baselineWindow
+	baseline       float64
+	baselineWindow time.Duration
+	seeded         bool
+}
+
+type activityBucket struct {
+	second   int64
+	messages int
+	// ids are the IDs of the messages counted, a message keeps its time so
+	// a replayed or restored copy always falls into the same bucket
+	ids      map[string]struct{}
+	chatters map[string]struct{}
+	emotes   map[string]int
+	phrases  map[string]int
+	// baseline is the baseline when the second started
+	baseline float64
+}
+
+// ChatActivityStats describe the chat during a window.
+type ChatActivityStats struct {
+	Window   time.Duration
+	Messages int
+	// Rate is in messages per second
+	Rate     float64
+	Chatters int
+	// Baseline is the usual rate before the window, in messages per second,
+	// so a spike is not measured against itself
+	Baseline   float64
+	TopEmotes  []Frequency
+	TopPhrases []Frequency
+}
+
+type Frequency struct {
+	Value string
+	Count int
+}
+
+// Spike reports whether the rate is at least factor times the baseline.
+func (s ChatActivityStats) Spike(factor float64) bool {
+	return s.Baseline > 0 && s.Rate >= factor*s.Baseline
+}
+
+// NewChatActivity keeps statistics for windows of up to maxWindow.
+func NewChatActivity(maxWindow time.Duration) *ChatActivity {
+	return &ChatActivity{
+		buckets:        make([]*activityBucket, max(int(maxWindow/time.Second), 1)),
+		baselineWindow: defaultBaselineWindow,
+	}
+}
+
+// SetBaselineWindow sets the time constant of the baseline, 10 minutes by
+// default.
+func (ca *ChatActivity) SetBaselineWindow(window time.Duration) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	ca.baselineWindow = window
+}
+
+func (ca *ChatActivity) Insert(message *MessageData) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	second := message.Time.Unix()
+	if second > ca.latest {
+		ca.advance(second)
+	}
+
+	bucket := ca.buckets[ca.index(second)]
+	if bucket == nil || bucket.second != second {
+		// Too old for the window
+		return
+	}
+
+	if message.ID != "" {
+		if _, ok := bucket.ids[message.ID]; ok {
+			return
+		}
+		bucket.ids[message.ID] = struct{}{}
+	}
+
+	bucket.messages++
+
+	// Chatters are told apart by their stable ID where it is known
+	chatter := message.UserID
+	if chatter == "" {
+		chatter = message.UserName
+	}
+	bucket.chatters[chatter] = struct{}{}
+
+	for _, emote := range message.Emotes {
+		bucket.emotes[emote.Name] += max(len(emote.Positions), 1)
+	}
+
+	if phrase := normalizePhrase(message.Message); phrase != "" {
+		bucket.phrases[phrase]++
+	}
+}
+
+// advance closes the seconds up to second, feeding them to the baseline, and
+// starts a bucket for second.
+func (ca *ChatActivity) advance(second int64) {
+	alpha := 1 - math.Exp(-float64(time.Second)/float64(ca.baselineWindow))
+
+	if ca.latest > 0 {
+		if bucket := ca.buckets[ca.index(ca.latest)]; bucket != nil && bucket.second == ca.latest {
+			if !ca.seeded {
+				ca.baseline = float64(bucket.messages)
+				ca.seeded = true
+			} else {
+				ca.baseline += alpha * (float64(bucket.messages) - ca.baseline)
+			}
+		}
+
+		// The quiet seconds in between decay the baseline
+		ca.baseline *= math.Pow(1-alpha, float64(second-ca.latest-1))
+	}
+
+	ca.latest = second
+	ca.buckets[ca.index(second)] = &activityBucket{
+		second:   second,
+		ids:      make(map[string]struct{}),
+		chatters: make(map[string]struct{}),
+		emotes:   make(map[string]int),
+		phrases:  make(map[string]int),
+		baseline: ca.baseline,
+	}
+}
+
+func (ca *ChatActivity) index(second int64) int {
+	n := int64(len(ca.buckets))
+	return int((second%n + n) % n)
+}
+
+// Stats describe the window of chat up to t, e.g. at the time of a ban.
+func (ca *ChatActivity) Stats(t time.Time, window time.Duration) ChatActivityStats {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	stats := ChatActivityStats{
+		Window:   window,
+		Baseline: ca.baseline,
+	}
+
+	chatters := make(map[string]struct{})
+	emotes := make(map[string]int)
+	phrases := make(map[string]int)
+
+	end := t.Unix()
+	first := true
+	for second := end - int64(window/time.Second) + 1; second <= end; second++ {
+		bucket := ca.buckets[ca.index(second)]
+		if bucket == nil || bucket.second != second {
+			continue
+		}
+
+		if first {
+			stats.Baseline = bucket.baseline
+			first = false
+		}
+
+		stats.Messages += bucket.messages
+		for chatter := range bucket.chatters {
+			chatters[chatter] = struct{}{}
+		}
+		for emote, count := range bucket.emotes {
+			emotes[emote] += count
+		}
+		for phrase, count := range bucket.phrases {
+			phrases[phrase] += count
+		}
+	}
+
+	if window >= time.Second {
+		stats.Rate = float64(stats.Messages) / window.Seconds()
+	}
+	stats.Chatters = len(chatters)
+	stats.TopEmotes = topFrequencies(emotes)
+	stats.TopPhrases = topFrequencies(phrases)
+
+	return stats
+}
+
+// Baseline returns the current usual rate, in messages per second.
+func (ca *ChatActivity) Baseline() float64 {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	return ca.baseline
+}
+
+// Clear drops all statistics and the baseline.
+func (ca *ChatActivity) Clear() {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	clear(ca.buckets)
+	ca.latest = 0
+	ca.baseline = 0
+	ca.seeded = false
+}
+
+func topFrequencies(counts map[string]int) []Frequency {
+	frequencies := make([]Frequency, 0, len(counts))
+	for value, count := range counts {
+		frequencies = append(frequencies, Frequency{Value: value, Count: count})
+	}
+
+	slices.SortFunc(frequencies, func(a, b Frequency) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+
+		return cmp.Compare(a.Value, b.Value)
+	})
+
+	return frequencies[:min(len(frequencies), maxFrequencies)]
+}
+
+// normalizePhrase makes repeated messages count as one phrase regardless of
+// case and spacing.
+func normalizePhrase(message string) string {
+	return strings.Join(strings.Fields(strings.ToLower(message)), " ")
+}
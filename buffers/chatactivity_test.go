@@ -0,0 +1,75 @@
+package buffers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChatActivity(t *testing.T) {
+	start := time.Date(2025, 5, 11, 13, 40, 0, 0, time.UTC)
+	ca := NewChatActivity(time.Minute)
+	ca.SetBaselineWindow(10 * time.Second)
+
+	// A quiet minute of one message per second
+	for i := 0; i < 60; i++ {
+		ca.Insert(&MessageData{UserName: fmt.Sprintf("user%d", i%5), Message: "hi", Time: start.Add(time.Duration(i) * time.Second)})
+	}
+
+	quiet := ca.Stats(start.Add(59*time.Second), 10*time.Second)
+	assert.Equal(t, 10, quiet.Messages)
+	assert.Equal(t, 1.0, quiet.Rate)
+	assert.Equal(t, 5, quiet.Chatters)
+	assert.InDelta(t, 1.0, quiet.Baseline, 0.01)
+	assert.False(t, quiet.Spike(3))
+
+	// Followed by 5 seconds of everybody spamming an emote
+	spike := start.Add(60 * time.Second)
+	for i := 0; i < 100; i++ {
+		ca.Insert(&MessageData{
+			UserName: fmt.Sprintf("user%d", i),
+			Message:  "KEKW  KEKW",
+			Time:     spike.Add(time.Duration(i) * 50 * time.Millisecond),
+			Emotes:   []MessageEmote{{Name: "KEKW", Positions: []EmotePosition{{0, 3}, {6, 9}}}},
+		})
+	}
+
+	stats := ca.Stats(spike.Add(4*time.Second), 5*time.Second)
+	assert.Equal(t, 100, stats.Messages)
+	assert.Equal(t, 20.0, stats.Rate)
+	assert.Equal(t, 100, stats.Chatters)
+	assert.True(t, stats.Spike(3))
+	assert.Equal(t, []Frequency{{Value: "KEKW", Count: 200}}, stats.TopEmotes)
+	assert.Equal(t, []Frequency{{Value: "kekw kekw", Count: 100}}, stats.TopPhrases)
+
+	// The baseline catches up with the new rate
+	assert.Greater(t, ca.Baseline(), quiet.Baseline)
+
+	// Looking back at the quiet minute is still possible
+	assert.Equal(t, quiet, ca.Stats(start.Add(59*time.Second), 10*time.Second))
+}
+
+func TestChatActivityDuplicates(t *testing.T) {
+	start := time.Date(2025, 5, 11, 13, 40, 0, 0, time.UTC)
+	ca := NewChatActivity(time.Minute)
+
+	messages := []*MessageData{
+		{ID: "1", UserID: "42", UserName: "old_name", Message: "hi", Time: start},
+		// The same user after a rename
+		{ID: "2", UserID: "42", UserName: "new_name", Message: "hi", Time: start.Add(time.Second)},
+		{ID: "3", UserID: "43", UserName: "other", Message: "hi", Time: start.Add(2 * time.Second)},
+	}
+
+	// Restored from a snapshot and then replayed
+	for i := 0; i < 2; i++ {
+		for _, message := range messages {
+			ca.Insert(message)
+		}
+	}
+
+	stats := ca.Stats(start.Add(2*time.Second), 10*time.Second)
+	assert.Equal(t, 3, stats.Messages)
+	assert.Equal(t, 2, stats.Chatters)
+}
@@ -0,0 +1,113 @@
+package buffers
+
+import "time"
+
+// Clip is a continuous run of segments returned by the MediaBuffer queries.
+type Clip struct {
+	Segments []*MediaData
+	// Start is the wall-clock time of the first segment, zero when the clip
+	// is empty
+	Start    time.Time
+	Duration time.Duration
+	// Offset is where the time the clip was queried around falls inside it,
+	// e.g. T of Before or from of Between
+	Offset time.Duration
+	// Gaps are the segments missing inside the clip
+	Gaps []Gap
+}
+
+// NewClip makes a clip of segments, ordered like the MediaBuffer snapshots,
+// with the offset of at inside it unless at is zero.
+func NewClip(segments []*MediaData, at time.Time) *Clip {
+	clip := &Clip{
+		Segments: segments,
+		Gaps:     SegmentGaps(segments),
+	}
+
+	if len(segments) == 0 {
+		return clip
+	}
+
+	clip.Start = segments[0].ProgramDateTime
+	for _, segment := range segments {
+		clip.Duration += segment.duration()
+	}
+
+	if !at.IsZero() {
+		clip.Offset = clip.OffsetOf(at)
+	}
+
+	return clip
+}
+
+// OffsetOf returns where t falls inside the clip, clamped to its bounds.
+func (c *Clip) OffsetOf(t time.Time) time.Duration {
+	offset := t.Sub(c.Start)
+
+	if offset < 0 {
+		return 0
+	}
+
+	if offset > c.Duration {
+		return c.Duration
+	}
+
+	return offset
+}
+
+// Release releases the data of the clip's segments.
+func (c *Clip) Release() {
+	ReleaseSegments(c.Segments)
+}
+
+func (md *MediaData) duration() time.Duration {
+	return time.Duration(md.Duration * float64(time.Second))
+}
+
+func (md *MediaData) end() time.Time {
+	return md.ProgramDateTime.Add(md.duration())
+}
+
+// Between returns the segments overlapping the wall-clock range from-to, with
+// the offset of from inside the clip.
+func (mb *MediaBuffer) Between(from, to time.Time) *Clip {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+
+	segments := make([]*MediaData, 0)
+	for _, segment := range mb.segments.Items() {
+		if segment.ProgramDateTime.IsZero() || !segment.end().After(from) || !segment.ProgramDateTime.Before(to) {
+			continue
+		}
+
+		segments = append(segments, segment.retain())
+	}
+
+	return NewClip(segments, from)
+}
+
+// Before returns the last duration of video up to t, with the offset of t
+// inside the clip.
+func (mb *MediaBuffer) Before(t time.Time, duration time.Duration) *Clip {
+	clip := mb.Between(t.Add(-duration), t)
+	clip.Offset = clip.OffsetOf(t)
+
+	return clip
+}
+
+// BetweenSeqIds returns the segments of epoch with SeqIds from-to inclusive.
+func (mb *MediaBuffer) BetweenSeqIds(epoch, from, to uint64) *Clip {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+
+	segments := make([]*MediaData, 0)
+	for _, segment := range mb.segments.Items() {
+		if segment.Epoch != epoch || segment.SeqId < from || segment.SeqId > to {
+			continue
+		}
+
+		segments = append(segments, segment.retain())
+	}
+
+	return NewClip(segments, time.Time{})
+}
@@ -0,0 +1,51 @@
+package buffers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMediaBufferQueries(t *testing.T) {
+	start := time.Date(2025, 5, 11, 13, 40, 0, 0, time.UTC)
+	mb := NewMediaBuffer(90)
+
+	for i := 0; i < 10; i++ {
+		mb.Insert(&MediaData{
+			SeqId:           uint64(100 + i),
+			Duration:        2,
+			ProgramDateTime: start.Add(time.Duration(i) * 2 * time.Second),
+		})
+	}
+
+	seqIds := func(clip *Clip) []uint64 {
+		ids := make([]uint64, len(clip.Segments))
+		for i, segment := range clip.Segments {
+			ids[i] = segment.SeqId
+		}
+		return ids
+	}
+
+	between := mb.Between(start.Add(3*time.Second), start.Add(7*time.Second))
+	defer between.Release()
+	assert.Equal(t, []uint64{101, 102, 103}, seqIds(between))
+	assert.Equal(t, start.Add(2*time.Second), between.Start)
+	assert.Equal(t, 6*time.Second, between.Duration)
+	assert.Equal(t, time.Second, between.Offset)
+
+	ban := start.Add(15500 * time.Millisecond)
+	before := mb.Before(ban, 5*time.Second)
+	defer before.Release()
+	assert.Equal(t, []uint64{105, 106, 107}, seqIds(before))
+	assert.Equal(t, 5500*time.Millisecond, before.Offset)
+
+	bySeqId := mb.BetweenSeqIds(0, 108, 120)
+	defer bySeqId.Release()
+	assert.Equal(t, []uint64{108, 109}, seqIds(bySeqId))
+	assert.Equal(t, time.Duration(0), bySeqId.Offset)
+
+	empty := mb.Between(start.Add(time.Hour), start.Add(2*time.Hour))
+	assert.Empty(t, empty.Segments)
+	assert.True(t, empty.Start.IsZero())
+}
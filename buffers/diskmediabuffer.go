@@ -0,0 +1,107 @@
+package buffers
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// segmentFile is a segment body spilled to disk. It is reference counted like
+// Bytes, and deleted once the last reference is released.
+type segmentFile struct {
+	path string
+	size int64
+	refs atomic.Int32
+}
+
+func (sf *segmentFile) open() (io.ReadCloser, error) {
+	return os.Open(sf.path)
+}
+
+func (sf *segmentFile) retain() {
+	sf.refs.Add(1)
+}
+
+func (sf *segmentFile) release() {
+	if sf.refs.Add(-1) == 0 {
+		os.Remove(sf.path)
+	}
+}
+
+// DiskMediaBuffer is a MediaBuffer that writes segment bodies to a rolling
+// directory and keeps only their index in memory, so it can hold a window of
+// tens of minutes per channel.
+type DiskMediaBuffer struct {
+	*MediaBuffer
+
+	dir string
+}
+
+// NewDiskMediaBuffer creates a buffer spilling to dir, removing segments left
+// there by a previous run.
+func NewDiskMediaBuffer(dir string, maxDuration int) (*DiskMediaBuffer, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	stale, err := filepath.Glob(filepath.Join(dir, "*.ts"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range stale {
+		os.Remove(path)
+	}
+
+	return &DiskMediaBuffer{
+		MediaBuffer: NewMediaBuffer(maxDuration),
+		dir:         dir,
+	}, nil
+}
+
+// Insert writes the segment to disk and releases its in-memory data. When the
+// write fails the segment is kept in memory rather than lost.
+func (db *DiskMediaBuffer) Insert(segment *MediaData) {
+	if segment.Data == nil || db.Contains(segment.Epoch, segment.SeqId) {
+		db.MediaBuffer.Insert(segment)
+		return
+	}
+
+	file, err := db.spill(segment)
+	if err != nil {
+		db.MediaBuffer.Insert(segment)
+		return
+	}
+
+	spilled := *segment
+	spilled.Data = nil
+	spilled.file = file
+	segment.Data.Release()
+
+	db.MediaBuffer.Insert(&spilled)
+}
+
+func (db *DiskMediaBuffer) spill(segment *MediaData) (*segmentFile, error) {
+	// Concurrent inserts of the same segment must not share a file
+	f, err := os.CreateTemp(db.dir, fmt.Sprintf("%d-%d-*.ts", segment.Epoch, segment.SeqId))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = f.Write(segment.Data.Bytes())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+
+	file := &segmentFile{path: f.Name(), size: int64(segment.Data.Len())}
+	file.refs.Store(1)
+	return file, nil
+}
@@ -0,0 +1,54 @@
+package buffers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiskMediaBuffer(t *testing.T) {
+	dir := t.TempDir()
+	pool := NewBytePool()
+
+	db, err := NewDiskMediaBuffer(dir, 4)
+	assert.NoError(t, err)
+
+	insert := func(seqId uint64) {
+		data := pool.Get()
+		data.ReadFrom(bytes.NewReader([]byte(fmt.Sprintf("segment %d;", seqId))))
+		db.Insert(&MediaData{SeqId: seqId, Data: data, Duration: 2})
+	}
+
+	insert(1)
+	insert(2)
+	insert(2)
+
+	snapshot := db.Segments()
+	assert.Len(t, snapshot, 2)
+	assert.Nil(t, snapshot[0].Data)
+
+	files, _ := os.ReadDir(dir)
+	assert.Len(t, files, 2)
+
+	// Evicts 1 and 2, but the snapshot still holds them
+	insert(3)
+	insert(4)
+	files, _ = os.ReadDir(dir)
+	assert.Len(t, files, 4)
+
+	body, err := io.ReadAll(SegmentsReader(snapshot))
+	assert.NoError(t, err)
+	assert.Equal(t, "segment 1;segment 2;", string(body))
+
+	ReleaseSegments(snapshot)
+	files, _ = os.ReadDir(dir)
+	assert.Len(t, files, 2)
+
+	db.Clear()
+	files, _ = os.ReadDir(dir)
+	assert.Empty(t, files)
+}
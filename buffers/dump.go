@@ -0,0 +1,41 @@
+package buffers
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	dumpMedia = "media.ts"
+	dumpChat  = "chat.ndjson"
+)
+
+// Dump writes everything media and messages hold right now to dir, the video
+// as media.ts and the chat as chat.ndjson, e.g. for debugging or an incident
+// no trigger caught. Unlike Snapshot it leaves the buffers as they are.
+func Dump(dir string, media MediaStore, messages *MessagesBuffer) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	segments := media.Segments()
+	defer ReleaseSegments(segments)
+
+	f, err := os.Create(filepath.Join(dir, dumpMedia))
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, SegmentsReader(segments))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return writeNDJSON(filepath.Join(dir, dumpChat), messages.Messages())
+}
@@ -0,0 +1,42 @@
+package buffers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDump(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dump")
+	pool := NewBytePool()
+	now := time.Now()
+
+	media := NewMediaBuffer(90)
+	for _, body := range []string{"first;", "second;"} {
+		data := pool.Get()
+		data.ReadFrom(strings.NewReader(body))
+		media.Insert(&MediaData{SeqId: uint64(media.Stats().Segments), Data: data, Duration: 2})
+	}
+
+	messages := NewMessagesBuffer(600)
+	messages.Insert(&MessageData{ID: "1", UserName: "a", Message: "hi", Time: now})
+	messages.Insert(&MessageData{ID: "2", UserName: "b", Message: "hello", Time: now})
+
+	assert.NoError(t, Dump(dir, media, messages))
+
+	body, err := os.ReadFile(filepath.Join(dir, "media.ts"))
+	assert.NoError(t, err)
+	assert.Equal(t, "first;second;", string(body))
+
+	chat, err := os.ReadFile(filepath.Join(dir, "chat.ndjson"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(chat), "\n"))
+
+	// The buffers are left alone
+	assert.Equal(t, 2, media.Stats().Segments)
+	assert.Len(t, messages.Messages(), 2)
+}
@@ -0,0 +1,76 @@
+package buffers
+
+import "time"
+
+// Gap is a run of segments missing between two buffered segments of the same
+// epoch, e.g. because their download failed.
+type Gap struct {
+	Epoch uint64
+	// FromSeqId and ToSeqId are the missing SeqIds, inclusive
+	FromSeqId uint64
+	ToSeqId   uint64
+	// Duration is the wall-clock time between the segments around the gap,
+	// or estimated from the segment before it when their times are unknown
+	Duration time.Duration
+}
+
+// Segments is the number of missing segments.
+func (g Gap) Segments() int {
+	return int(g.ToSeqId-g.FromSeqId) + 1
+}
+
+// SegmentGaps returns the gaps inside segments, which must be ordered like the
+// MediaBuffer snapshots.
+func SegmentGaps(segments []*MediaData) []Gap {
+	gaps := make([]Gap, 0)
+
+	for i := 1; i < len(segments); i++ {
+		prev, next := segments[i-1], segments[i]
+		if prev.Epoch != next.Epoch || next.SeqId <= prev.SeqId+1 {
+			continue
+		}
+
+		gap := Gap{
+			Epoch:     next.Epoch,
+			FromSeqId: prev.SeqId + 1,
+			ToSeqId:   next.SeqId - 1,
+		}
+
+		if !prev.ProgramDateTime.IsZero() && !next.ProgramDateTime.IsZero() {
+			gap.Duration = max(next.ProgramDateTime.Sub(prev.end()), 0)
+		} else {
+			gap.Duration = time.Duration(gap.Segments()) * prev.duration()
+		}
+
+		gaps = append(gaps, gap)
+	}
+
+	return gaps
+}
+
+// Gaps returns the gaps in the buffered segments, oldest first.
+func (mb *MediaBuffer) Gaps() []Gap {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+
+	return SegmentGaps(mb.segments.Items())
+}
+
+// Complete reports whether no segment is missing inside the clip.
+func (c *Clip) Complete() bool {
+	return len(c.Gaps) == 0
+}
+
+// MissingDuration is the total duration of the clip's gaps.
+func (c *Clip) MissingDuration() time.Duration {
+	return gapsDuration(c.Gaps)
+}
+
+func gapsDuration(gaps []Gap) time.Duration {
+	var duration time.Duration
+	for _, gap := range gaps {
+		duration += gap.Duration
+	}
+
+	return duration
+}
@@ -0,0 +1,48 @@
+package buffers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMediaBufferGaps(t *testing.T) {
+	start := time.Date(2025, 5, 11, 13, 40, 0, 0, time.UTC)
+	mb := NewMediaBuffer(90)
+
+	insert := func(epoch, seqId uint64, pdt time.Time) {
+		mb.Insert(&MediaData{Epoch: epoch, SeqId: seqId, Duration: 2, ProgramDateTime: pdt})
+	}
+
+	insert(0, 100, start)
+	insert(0, 101, start.Add(2*time.Second))
+	insert(0, 104, start.Add(8*time.Second))
+	// Unknown times are estimated from the segment before the gap
+	insert(0, 107, time.Time{})
+	// A new epoch is no gap
+	insert(1, 3, start.Add(20*time.Second))
+
+	gaps := mb.Gaps()
+	assert.Equal(t, []Gap{
+		{Epoch: 0, FromSeqId: 102, ToSeqId: 103, Duration: 4 * time.Second},
+		{Epoch: 0, FromSeqId: 105, ToSeqId: 106, Duration: 4 * time.Second},
+	}, gaps)
+
+	stats := mb.Stats()
+	assert.Equal(t, 4, stats.MissingSegments)
+	assert.Equal(t, 8*time.Second, stats.MissingDuration)
+
+	clip := mb.Between(start, start.Add(10*time.Second))
+	defer clip.Release()
+	assert.False(t, clip.Complete())
+	assert.Equal(t, 4*time.Second, clip.MissingDuration())
+
+	// The late segments fill the gap
+	insert(0, 102, start.Add(4*time.Second))
+	insert(0, 103, start.Add(6*time.Second))
+
+	complete := mb.Between(start, start.Add(10*time.Second))
+	defer complete.Release()
+	assert.True(t, complete.Complete())
+}
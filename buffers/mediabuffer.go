@@ -1,63 +1,327 @@
 package buffers
 
-import "slices"
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
 
+// MediaStore is a rolling window of media segments, kept either in memory by
+// MediaBuffer or on disk by DiskMediaBuffer.
+type MediaStore interface {
+	// Insert takes over the reference to segment.Data
+	Insert(segment *MediaData)
+	Contains(epoch, seqId uint64) bool
+	Clear()
+	// Segments and SegmentsAlignedWith return snapshots that must be released
+	// with ReleaseSegments
+	Segments() []*MediaData
+	SegmentsAlignedWith(segments []*MediaData) []*MediaData
+	// Between, Before and BetweenSeqIds return clips that must be released
+	// with Clip.Release
+	Between(from, to time.Time) *Clip
+	Before(t time.Time, duration time.Duration) *Clip
+	BetweenSeqIds(epoch, from, to uint64) *Clip
+	Capture(t time.Time, preRoll, postRoll time.Duration) *ClipCapture
+	SetMaxBytes(maxBytes int64)
+	SetMaxDuration(maxDuration time.Duration)
+	MaxDuration() time.Duration
+	Stats() MediaBufferStats
+	Gaps() []Gap
+	// Snapshot and Restore carry the buffer over a restart
+	Snapshot(dir string) error
+	Restore(dir string) error
+}
+
+type MediaBufferStats struct {
+	Bytes    int64
+	Duration time.Duration
+	Segments int
+	// MissingSegments and MissingDuration add up the buffer's gaps
+	MissingSegments int
+	MissingDuration time.Duration
+}
+
+// MediaData is never modified once inserted into a MediaBuffer, so it can be
+// shared between snapshots.
 type MediaData struct {
-	SeqId    uint64
-	Data     *[]byte
+	// Epoch increases every time the stream's media sequence restarts, so
+	// segments are ordered by (Epoch, SeqId).
+	Epoch uint64
+	SeqId uint64
+	// Data is nil once the segment was spilled to disk
+	Data     *Bytes
 	Duration float64
+	// ProgramDateTime is the wall-clock time of the start of the segment
+	ProgramDateTime time.Time
+
+	file *segmentFile
+}
+
+// Open returns a reader of the segment body, wherever it is kept.
+func (md *MediaData) Open() (io.ReadCloser, error) {
+	if md.file != nil {
+		return md.file.open()
+	}
+
+	if md.Data == nil {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	return io.NopCloser(bytes.NewReader(md.Data.Bytes())), nil
+}
+
+// Size is the length of the segment body.
+func (md *MediaData) Size() int64 {
+	if md.file != nil {
+		return md.file.size
+	}
+
+	if md.Data == nil {
+		return 0
+	}
+
+	return int64(md.Data.Len())
+}
+
+func (md *MediaData) retain() *MediaData {
+	if md.Data != nil {
+		md.Data.Retain()
+	}
+
+	if md.file != nil {
+		md.file.retain()
+	}
+
+	return md
+}
+
+func (md *MediaData) release() {
+	if md.Data != nil {
+		md.Data.Release()
+	}
+
+	if md.file != nil {
+		md.file.release()
+	}
+}
+
+func (md *MediaData) before(other *MediaData) bool {
+	if md.Epoch != other.Epoch {
+		return md.Epoch < other.Epoch
+	}
+
+	return md.SeqId < other.SeqId
+}
+
+// segmentKey identifies a segment across epochs.
+type segmentKey struct {
+	epoch, seqId uint64
 }
 
+// MediaBuffer is safe for concurrent use.
 type MediaBuffer struct {
-	segments    []*MediaData
-	duration    float64
-	maxDuration float64
+	mu sync.RWMutex
+
+	segments *Ring[segmentKey, *MediaData]
+
+	captures []*ClipCapture
+	// liveEdge is the end of the newest segment ever inserted, it survives
+	// Clear so pending captures carry over a reconnect
+	liveEdge time.Time
 }
 
 func NewMediaBuffer(maxDuration int) *MediaBuffer {
+	segments := NewRing(func(segment *MediaData) segmentKey {
+		return segmentKey{segment.Epoch, segment.SeqId}
+	})
+	segments.SetLess((*MediaData).before)
+	segments.SetMaxWeight("duration", float64(maxDuration), func(segment *MediaData) float64 {
+		return segment.Duration
+	})
+	segments.SetMaxWeight("bytes", 0, func(segment *MediaData) float64 {
+		return float64(segment.Size())
+	})
+	segments.OnEvict((*MediaData).release)
+
 	return &MediaBuffer{
-		segments:    make([]*MediaData, 0, maxDuration),
-		maxDuration: float64(maxDuration),
+		segments: segments,
 	}
 }
 
+// SetMaxBytes caps the buffer by the size of the segment bodies too, segments
+// are evicted as soon as either limit is hit. 0 means no byte limit.
+func (mb *MediaBuffer) SetMaxBytes(maxBytes int64) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.segments.SetMaxWeight("bytes", float64(maxBytes), func(segment *MediaData) float64 {
+		return float64(segment.Size())
+	})
+}
+
+// SetMaxDuration changes how much video the buffer keeps.
+func (mb *MediaBuffer) SetMaxDuration(maxDuration time.Duration) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.segments.SetMaxWeight("duration", maxDuration.Seconds(), func(segment *MediaData) float64 {
+		return segment.Duration
+	})
+}
+
+func (mb *MediaBuffer) MaxDuration() time.Duration {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+
+	return time.Duration(mb.segments.MaxWeight("duration") * float64(time.Second))
+}
+
+// SetMaxSegments caps the number of segments on top of the duration. 0 means
+// no count limit.
+func (mb *MediaBuffer) SetMaxSegments(maxSegments int) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.segments.SetMaxCount(maxSegments)
+}
+
+// Insert takes over the reference to segment.Data, which is released once the
+// segment is evicted or turns out to be a duplicate.
 func (mb *MediaBuffer) Insert(segment *MediaData) {
-	pos := 0
-	for i := 0; i < len(mb.segments); i++ {
-		seg := mb.segments[i]
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
 
-		// Dont allow duplicates
-		if segment.SeqId == seg.SeqId {
-			return
-		}
+	// Captures have to see the segment before it can be evicted
+	segment.retain()
+	defer segment.release()
 
-		if segment.SeqId < seg.SeqId {
-			pos = i
-			break
-		}
+	if !mb.segments.Insert(segment) {
+		segment.release()
+		return
+	}
+
+	mb.notifyCaptures(segment)
+}
+
+func (mb *MediaBuffer) Contains(epoch, seqId uint64) bool {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+
+	return mb.segments.Contains(segmentKey{epoch, seqId})
+}
+
+// Clear evicts all segments. Pending captures keep the segments they
+// collected and go on with the ones inserted afterwards.
+func (mb *MediaBuffer) Clear() {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.segments.Clear()
+}
+
+func (mb *MediaBuffer) Stats() MediaBufferStats {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+
+	stats := MediaBufferStats{
+		Bytes:    int64(mb.segments.Weight("bytes")),
+		Duration: time.Duration(mb.segments.Weight("duration") * float64(time.Second)),
+		Segments: mb.segments.Len(),
+	}
+
+	gaps := SegmentGaps(mb.segments.Items())
+	for _, gap := range gaps {
+		stats.MissingSegments += gap.Segments()
+	}
+	stats.MissingDuration = gapsDuration(gaps)
+
+	return stats
+}
 
-		pos = i + 1
+// Segments returns a snapshot of the buffered segments, with their data
+// retained so it stays valid after eviction. Call ReleaseSegments once done
+// with them.
+func (mb *MediaBuffer) Segments() []*MediaData {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+
+	segments := make([]*MediaData, mb.segments.Len())
+	for i, segment := range mb.segments.Items() {
+		segments[i] = segment.retain()
+	}
+
+	return segments
+}
+
+// SegmentsAlignedWith returns, like Segments, the buffered segments covering
+// the same range as segments, e.g. the same part of the stream in another
+// rendition.
+func (mb *MediaBuffer) SegmentsAlignedWith(segments []*MediaData) []*MediaData {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+
+	aligned := make([]*MediaData, 0, len(segments))
+	if len(segments) == 0 {
+		return aligned
 	}
 
-	mb.segments = append(mb.segments, nil)
-	copy(mb.segments[pos+1:], mb.segments[pos:])
-	mb.segments[pos] = segment
-	mb.duration += segment.Duration
+	first, last := segments[0], segments[len(segments)-1]
+	for _, segment := range mb.segments.Items() {
+		if segment.before(first) || last.before(segment) {
+			continue
+		}
 
-	for mb.duration > mb.maxDuration && len(mb.segments) > 0 {
-		mb.duration -= mb.segments[0].Duration
-		copy(mb.segments, mb.segments[1:])
-		mb.segments[len(mb.segments)-1] = nil
-		mb.segments = mb.segments[:len(mb.segments)-1]
+		aligned = append(aligned, segment.retain())
 	}
+
+	return aligned
 }
 
-func (mb *MediaBuffer) Contains(seqId uint64) bool {
-	return slices.ContainsFunc(mb.segments, func(seg *MediaData) bool {
-		return seg.SeqId == seqId
-	})
+// SegmentsReader reads the bodies of segments one after another, opening each
+// one only once the previous one was read.
+func SegmentsReader(segments []*MediaData) io.Reader {
+	return &segmentsReader{segments: segments}
 }
 
-func (mb *MediaBuffer) Segments() []*MediaData {
-	return mb.segments
+type segmentsReader struct {
+	segments []*MediaData
+	current  io.ReadCloser
+}
+
+func (sr *segmentsReader) Read(p []byte) (int, error) {
+	for {
+		if sr.current == nil {
+			if len(sr.segments) == 0 {
+				return 0, io.EOF
+			}
+
+			current, err := sr.segments[0].Open()
+			if err != nil {
+				return 0, err
+			}
+
+			sr.current = current
+			sr.segments = sr.segments[1:]
+		}
+
+		n, err := sr.current.Read(p)
+		if err == io.EOF {
+			sr.current.Close()
+			sr.current = nil
+			err = nil
+		}
+
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// ReleaseSegments releases the data of segments returned by Segments.
+func ReleaseSegments(segments []*MediaData) {
+	for _, segment := range segments {
+		segment.release()
+	}
 }
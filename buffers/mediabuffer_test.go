@@ -0,0 +1,104 @@
+package buffers
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMediaBufferInsert(t *testing.T) {
+	mb := NewMediaBuffer(6)
+
+	// Out of order, duplicated and across an encoder restart
+	for _, segment := range []*MediaData{
+		{Epoch: 0, SeqId: 11, Duration: 2},
+		{Epoch: 1, SeqId: 1, Duration: 2},
+		{Epoch: 0, SeqId: 10, Duration: 2},
+		{Epoch: 0, SeqId: 11, Duration: 2},
+		{Epoch: 1, SeqId: 2, Duration: 2},
+	} {
+		mb.Insert(segment)
+	}
+
+	segments := mb.Segments()
+	keys := make([][2]uint64, len(segments))
+	for i, segment := range segments {
+		keys[i] = [2]uint64{segment.Epoch, segment.SeqId}
+	}
+
+	assert.Equal(t, [][2]uint64{{0, 11}, {1, 1}, {1, 2}}, keys)
+}
+
+func TestMediaBufferSnapshot(t *testing.T) {
+	mb := NewMediaBuffer(4)
+	mb.Insert(&MediaData{SeqId: 1, Duration: 2})
+	mb.Insert(&MediaData{SeqId: 2, Duration: 2})
+
+	snapshot := mb.Segments()
+	mb.Insert(&MediaData{SeqId: 0, Duration: 2})
+	mb.Insert(&MediaData{SeqId: 3, Duration: 2})
+	mb.Clear()
+
+	assert.Len(t, snapshot, 2)
+	assert.Equal(t, uint64(1), snapshot[0].SeqId)
+	assert.Equal(t, uint64(2), snapshot[1].SeqId)
+}
+
+func TestMediaBufferConcurrentAccess(t *testing.T) {
+	pool := NewBytePool()
+	mb := NewMediaBuffer(20)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				mb.Insert(&MediaData{SeqId: uint64(i*4 + w), Data: pool.Get(), Duration: 2})
+			}
+		}(w)
+
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				segments := mb.Segments()
+				for _, segment := range segments {
+					segment.Data.Len()
+				}
+				ReleaseSegments(segments)
+				mb.Contains(0, uint64(i))
+			}
+		}()
+	}
+
+	wg.Wait()
+	assert.LessOrEqual(t, len(mb.Segments()), 10)
+}
+
+func TestMediaBufferMaxBytes(t *testing.T) {
+	pool := NewBytePool()
+	mb := NewMediaBuffer(90)
+	mb.SetMaxBytes(10)
+
+	insert := func(seqId uint64, body string, duration float64) {
+		data := pool.Get()
+		data.ReadFrom(strings.NewReader(body))
+		mb.Insert(&MediaData{SeqId: seqId, Data: data, Duration: duration})
+	}
+
+	insert(1, "aaaa", 2)
+	insert(2, "bbbb", 2)
+	assert.Equal(t, MediaBufferStats{Bytes: 8, Duration: 4 * time.Second, Segments: 2}, mb.Stats())
+
+	// A bogus duration does not let the buffer grow past its byte budget
+	insert(3, "cccc", 0)
+	assert.Equal(t, MediaBufferStats{Bytes: 8, Duration: 2 * time.Second, Segments: 2}, mb.Stats())
+	assert.False(t, mb.Contains(0, 1))
+
+	mb.SetMaxBytes(4)
+	assert.Equal(t, MediaBufferStats{Bytes: 4, Duration: 0, Segments: 1}, mb.Stats())
+}
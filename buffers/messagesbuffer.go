@@ -2,76 +2,324 @@ package buffers
 
 import (
 	"slices"
+	"sync"
 	"time"
 )
 
+// MessageData is never modified once inserted into a MessagesBuffer, so it can
+// be shared between snapshots.
 type MessageData struct {
 	ID       string
 	Message  string
 	UserName string
 	Time     time.Time
+
+	// UserID is stable, unlike UserName which changes when the user renames
+	UserID        string
+	DisplayName   string
+	Color         string
+	Badges        map[string]int
+	IsBroadcaster bool
+	IsMod         bool
+	IsVip         bool
+
+	Emotes       []MessageEmote
+	Bits         int
+	Action       bool
+	FirstMessage bool
+	Reply        *MessageReply
+	// Tags are all IRC tags of the message, raw
+	Tags map[string]string
+
+	// Removal is set once a moderator removed the message. The buffer then
+	// holds a copy with it set, the original text is kept.
+	Removal *MessageRemoval
 }
 
+type RemovalAction string
+
+const (
+	RemovalDelete  RemovalAction = "delete"
+	RemovalTimeout RemovalAction = "timeout"
+	RemovalBan     RemovalAction = "ban"
+)
+
+// MessageRemoval is how and when a message was removed from chat.
+type MessageRemoval struct {
+	Action RemovalAction
+	Time   time.Time
+	// Duration is the length of a timeout
+	Duration time.Duration
+}
+
+type MessageEmote struct {
+	ID        string
+	Name      string
+	Positions []EmotePosition
+}
+
+// EmotePosition is the range of runes of the message an emote takes,
+// inclusive.
+type EmotePosition struct {
+	Start int
+	End   int
+}
+
+// MessageReply is the message a message was a reply to.
+type MessageReply struct {
+	ParentMsgID       string
+	ParentUserID      string
+	ParentUserLogin   string
+	ParentDisplayName string
+	ParentMsgBody     string
+}
+
+// IsSubscriber reports whether the user wore a subscriber badge.
+func (md *MessageData) IsSubscriber() bool {
+	_, ok := md.Badges["subscriber"]
+	return ok
+}
+
+// IsRemoved reports whether a moderator deleted the message, or purged it with
+// a timeout or ban.
+func (md *MessageData) IsRemoved() bool {
+	return md.Removal != nil
+}
+
+// MessagesBuffer is safe for concurrent use.
 type MessagesBuffer struct {
-	messages    []*MessageData
-	maxTimeDiff float64
+	mu sync.RWMutex
+
+	messages    *Ring[string, *MessageData]
+	maxTimeDiff time.Duration
+
+	// byUserName and byUserID index messages, oldest first like messages
+	byUserName userIndex
+	byUserID   userIndex
 }
 
+// NewMessagesBuffer creates a buffer keeping the last maxTimeDiff seconds of
+// chat.
 func NewMessagesBuffer(maxTimeDiff int) *MessagesBuffer {
-	return &MessagesBuffer{
-		messages:    make([]*MessageData, 0, maxTimeDiff),
-		maxTimeDiff: float64(maxTimeDiff),
+	mb := &MessagesBuffer{
+		messages:    NewRing(func(msg *MessageData) string { return msg.ID }),
+		maxTimeDiff: time.Duration(maxTimeDiff) * time.Second,
+		byUserName:  make(userIndex),
+		byUserID:    make(userIndex),
 	}
+
+	mb.messages.SetMaxAge(mb.maxTimeDiff, func(msg *MessageData) time.Time {
+		return msg.Time
+	})
+	mb.messages.OnEvict(func(msg *MessageData) {
+		mb.byUserName.remove(msg.UserName, msg)
+		mb.byUserID.remove(msg.UserID, msg)
+	})
+
+	return mb
+}
+
+// SetMaxCount caps the number of messages on top of the time window, for
+// bursts in large channels. 0 means no count limit.
+func (mb *MessagesBuffer) SetMaxCount(maxCount int) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.messages.SetMaxCount(maxCount)
+}
+
+// userIndex holds the buffered messages of every user, oldest first.
+type userIndex map[string][]*MessageData
+
+func (ui userIndex) add(key string, msg *MessageData) {
+	if key == "" {
+		return
+	}
+
+	ui[key] = append(ui[key], msg)
+}
+
+// remove drops msg, which must be the user's oldest message as messages are
+// evicted in order.
+func (ui userIndex) remove(key string, msg *MessageData) {
+	messages := ui[key]
+	if len(messages) == 0 || messages[0] != msg {
+		return
+	}
+
+	if len(messages) == 1 {
+		delete(ui, key)
+		return
+	}
+
+	messages[0] = nil
+	ui[key] = messages[1:]
 }
 
+func (ui userIndex) replace(key string, old, msg *MessageData) {
+	if i := slices.Index(ui[key], old); i >= 0 {
+		ui[key][i] = msg
+	}
+}
+
+// Insert adds message unless it is already buffered, evicting messages
+// outside the window.
 func (mb *MessagesBuffer) Insert(message *MessageData) {
-	pos := 0
-	for i := 0; i < len(mb.messages); i++ {
-		msg := mb.messages[i]
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
 
-		// Dont allow duplicates
-		if msg.ID == message.ID {
-			return
-		}
+	// The message might be evicted right away when it is already outside
+	// the window
+	if !mb.messages.Insert(message) || !mb.messages.Contains(message.ID) {
+		return
+	}
 
-		if message.Time.Sub(msg.Time).Seconds() <= mb.maxTimeDiff {
-			pos = i
-			break
-		}
+	mb.byUserName.add(message.UserName, message)
+	mb.byUserID.add(message.UserID, message)
+}
+
+// Delete marks the message with id as removed, e.g. on a CLEARMSG. It reports
+// whether the message was buffered and not removed already.
+func (mb *MessagesBuffer) Delete(id string, removal MessageRemoval) bool {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	msg, ok := mb.messages.Get(id)
+	if !ok || msg.IsRemoved() {
+		return false
 	}
 
-	if pos > 0 {
-		copy(mb.messages, mb.messages[pos:])
-		for i := len(mb.messages) - pos; i < len(mb.messages); i++ {
-			mb.messages[i] = nil
+	mb.remove(msg, removal)
+	return true
+}
+
+// Purge marks the messages userID sent until the removal as removed, e.g. on
+// a timeout or ban. It returns how many were marked.
+func (mb *MessagesBuffer) Purge(userID string, removal MessageRemoval) int {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	removed := 0
+	for _, msg := range mb.byUserID[userID] {
+		if msg.IsRemoved() || msg.Time.After(removal.Time) {
+			continue
 		}
-		mb.messages = mb.messages[:len(mb.messages)-pos]
-	}
 
-	if len(mb.messages) == cap(mb.messages) {
-		copy(mb.messages, mb.messages[1:])
-		mb.messages[len(mb.messages)-1] = nil
-		mb.messages = mb.messages[:len(mb.messages)-1]
+		mb.remove(msg, removal)
+		removed++
 	}
 
-	mb.messages = append(mb.messages, message)
+	return removed
+}
+
+// remove replaces msg with a removed copy, as messages are never modified
+// once inserted. It is called with the buffer locked.
+func (mb *MessagesBuffer) remove(msg *MessageData, removal MessageRemoval) {
+	tombstone := *msg
+	tombstone.Removal = &removal
+
+	mb.messages.Replace(&tombstone)
+	mb.byUserName.replace(msg.UserName, msg, &tombstone)
+	mb.byUserID.replace(msg.UserID, msg, &tombstone)
 }
 
+// GetByUserName returns the last limit messages of userName, oldest first. A
+// limit of 0 returns all of them.
 func (mb *MessagesBuffer) GetByUserName(userName string, limit int) []*MessageData {
-	result := make([]*MessageData, 0, 3)
+	return mb.GetByUserNameBetween(userName, time.Time{}, time.Time{}, limit)
+}
+
+// GetByUserNameBetween is like GetByUserName, but only returns messages sent
+// between from and to. A zero from or to leaves that end of the range open.
+func (mb *MessagesBuffer) GetByUserNameBetween(userName string, from, to time.Time, limit int) []*MessageData {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+
+	return filterMessages(mb.byUserName[userName], from, to, limit, nil)
+}
+
+// GetByUserID is like GetByUserName, but keyed by the stable user ID.
+func (mb *MessagesBuffer) GetByUserID(userID string, limit int) []*MessageData {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+
+	return filterMessages(mb.byUserID[userID], time.Time{}, time.Time{}, limit, nil)
+}
+
+// Around returns all messages sent from before t until after t, e.g. the
+// conversation surrounding a ban.
+func (mb *MessagesBuffer) Around(t time.Time, before, after time.Duration) []*MessageData {
+	return mb.query(t.Add(-before), t.Add(after), 0, nil)
+}
 
-	i := len(mb.messages) - 1
+// GetByID returns the message with the given ID, or nil when it is not
+// buffered.
+func (mb *MessagesBuffer) GetByID(id string) *MessageData {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
 
-	for i >= 0 && len(result) < 3 {
-		msg := mb.messages[i]
+	msg, _ := mb.messages.Get(id)
+	return msg
+}
+
+// Removed returns the messages removed between from and to, oldest first. A
+// zero from or to leaves that end of the range open.
+func (mb *MessagesBuffer) Removed(from, to time.Time) []*MessageData {
+	return mb.query(from, to, 0, (*MessageData).IsRemoved)
+}
+
+// Filter returns all messages matching predicate, oldest first.
+func (mb *MessagesBuffer) Filter(predicate func(msg *MessageData) bool) []*MessageData {
+	return mb.query(time.Time{}, time.Time{}, 0, predicate)
+}
+
+// query returns the last limit messages sent between from and to matching
+// predicate, oldest first. Zero values disable the respective condition.
+func (mb *MessagesBuffer) query(from, to time.Time, limit int, predicate func(msg *MessageData) bool) []*MessageData {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+
+	return filterMessages(mb.messages.Items(), from, to, limit, predicate)
+}
+
+// filterMessages is query over messages, which are ordered oldest first.
+func filterMessages(messages []*MessageData, from, to time.Time, limit int, predicate func(msg *MessageData) bool) []*MessageData {
+	result := make([]*MessageData, 0)
+
+	for i := len(messages) - 1; i >= 0 && (limit <= 0 || len(result) < limit); i-- {
+		msg := messages[i]
 
-		if msg.UserName == userName {
-			result = append(result, msg)
+		if !from.IsZero() && msg.Time.Before(from) {
+			continue
 		}
 
-		i--
+		if !to.IsZero() && msg.Time.After(to) {
+			continue
+		}
+
+		if predicate != nil && !predicate(msg) {
+			continue
+		}
+
+		result = append(result, msg)
 	}
 
 	slices.Reverse(result)
 	return result
 }
+
+// Messages returns a snapshot of the buffered messages.
+func (mb *MessagesBuffer) Messages() []*MessageData {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+
+	return slices.Clone(mb.messages.Items())
+}
+
+// Clear drops all messages.
+func (mb *MessagesBuffer) Clear() {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.messages.Clear()
+}
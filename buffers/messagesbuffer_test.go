@@ -0,0 +1,220 @@
+package buffers
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessagesBufferSnapshot(t *testing.T) {
+	mb := NewMessagesBuffer(600)
+	start := time.Now()
+
+	mb.Insert(&MessageData{ID: "1", UserName: "a", Message: "first", Time: start})
+	snapshot := mb.Messages()
+
+	mb.Insert(&MessageData{ID: "2", UserName: "a", Message: "second", Time: start.Add(time.Second)})
+	mb.Clear()
+
+	assert.Len(t, snapshot, 1)
+	assert.Equal(t, "first", snapshot[0].Message)
+}
+
+func TestMessagesBufferConcurrentAccess(t *testing.T) {
+	mb := NewMessagesBuffer(600)
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				mb.Insert(&MessageData{
+					ID:       fmt.Sprintf("%d-%d", w, i),
+					UserName: fmt.Sprintf("user%d", w),
+					Time:     start.Add(time.Duration(i) * time.Millisecond),
+				})
+			}
+		}(w)
+
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				mb.GetByUserName(fmt.Sprintf("user%d", w), 3)
+				mb.Messages()
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	assert.NotEmpty(t, mb.Messages())
+}
+
+func TestMessagesBufferQueries(t *testing.T) {
+	mb := NewMessagesBuffer(600)
+	start := time.Date(2025, 5, 11, 13, 40, 0, 0, time.UTC)
+
+	for i := 0; i < 10; i++ {
+		userName := "chatter"
+		if i%2 == 0 {
+			userName = "offender"
+		}
+
+		mb.Insert(&MessageData{
+			ID:       fmt.Sprint(i),
+			UserName: userName,
+			Message:  fmt.Sprintf("message %d", i),
+			Time:     start.Add(time.Duration(i) * time.Second),
+		})
+	}
+
+	ids := func(messages []*MessageData) []string {
+		result := make([]string, len(messages))
+		for i, msg := range messages {
+			result[i] = msg.ID
+		}
+		return result
+	}
+
+	assert.Equal(t, []string{"6", "8"}, ids(mb.GetByUserName("offender", 2)))
+	assert.Equal(t, []string{"0", "2", "4", "6", "8"}, ids(mb.GetByUserName("offender", 0)))
+	assert.Equal(t, []string{"2", "4"}, ids(mb.GetByUserNameBetween("offender", start.Add(time.Second), start.Add(5*time.Second), 0)))
+	assert.Equal(t, []string{"3", "4", "5", "6"}, ids(mb.Around(start.Add(5*time.Second), 2*time.Second, time.Second)))
+	assert.Equal(t, "message 7", mb.GetByID("7").Message)
+	assert.Nil(t, mb.GetByID("missing"))
+	assert.Equal(t, []string{"1", "9"}, ids(mb.Filter(func(msg *MessageData) bool {
+		return msg.Message == "message 1" || msg.Message == "message 9"
+	})))
+}
+
+func TestMessagesBufferIndexEviction(t *testing.T) {
+	mb := NewMessagesBuffer(600)
+	mb.SetMaxCount(10)
+	start := time.Now()
+
+	for i := 0; i < 30; i++ {
+		userName := fmt.Sprintf("user%d", i%3)
+		mb.Insert(&MessageData{ID: fmt.Sprint(i), UserName: userName, UserID: "id-" + userName, Time: start.Add(time.Duration(i) * time.Second)})
+	}
+
+	// Duplicates are rejected while still buffered
+	mb.Insert(&MessageData{ID: "29", UserName: "user2", Time: start.Add(30 * time.Second)})
+
+	assert.Len(t, mb.Messages(), 10)
+	assert.Len(t, mb.GetByUserName("user0", 0), 3)
+	assert.Len(t, mb.GetByUserID("id-user2", 0), 4)
+	assert.Nil(t, mb.GetByID("5"))
+	assert.NotNil(t, mb.GetByID("25"))
+
+	mb.Clear()
+	assert.Empty(t, mb.GetByUserName("user0", 0))
+	assert.Nil(t, mb.GetByID("25"))
+}
+
+// Around 20 messages per second from a few thousand chatters fill a 10 minute
+// window of a large channel.
+const (
+	benchmarkChatRate   = 20
+	benchmarkChatWindow = 600
+	benchmarkChatters   = 3000
+)
+
+func newBenchmarkMessagesBuffer() *MessagesBuffer {
+	size := benchmarkChatRate * benchmarkChatWindow
+	mb := NewMessagesBuffer(benchmarkChatWindow)
+	start := time.Now()
+
+	for i := 0; i < size; i++ {
+		userName := fmt.Sprintf("user%d", i%benchmarkChatters)
+		mb.Insert(&MessageData{
+			ID:       fmt.Sprint(i),
+			UserName: userName,
+			UserID:   "id-" + userName,
+			Time:     start.Add(time.Duration(i) * time.Second / benchmarkChatRate),
+		})
+	}
+
+	return mb
+}
+
+func BenchmarkMessagesBufferGetByUserName(b *testing.B) {
+	mb := newBenchmarkMessagesBuffer()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		mb.GetByUserName(fmt.Sprintf("user%d", i%benchmarkChatters), 3)
+	}
+}
+
+// BenchmarkMessagesBufferScanByUserName is the full scan GetByUserName did
+// before the index, for comparison.
+func BenchmarkMessagesBufferScanByUserName(b *testing.B) {
+	mb := newBenchmarkMessagesBuffer()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		userName := fmt.Sprintf("user%d", i%benchmarkChatters)
+		mb.Filter(func(msg *MessageData) bool {
+			return msg.UserName == userName
+		})
+	}
+}
+
+func BenchmarkMessagesBufferInsert(b *testing.B) {
+	mb := NewMessagesBuffer(benchmarkChatWindow)
+	start := time.Now()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		userName := fmt.Sprintf("user%d", i%benchmarkChatters)
+		mb.Insert(&MessageData{
+			ID:       fmt.Sprint(i),
+			UserName: userName,
+			UserID:   "id-" + userName,
+			Time:     start.Add(time.Duration(i) * time.Second / benchmarkChatRate),
+		})
+	}
+}
+
+func TestMessagesBufferRemoval(t *testing.T) {
+	mb := NewMessagesBuffer(600)
+	start := time.Now()
+
+	mb.Insert(&MessageData{ID: "1", UserName: "a", UserID: "10", Message: "first", Time: start})
+	mb.Insert(&MessageData{ID: "2", UserName: "b", UserID: "20", Message: "spam", Time: start.Add(time.Second)})
+	mb.Insert(&MessageData{ID: "3", UserName: "a", UserID: "10", Message: "second", Time: start.Add(2 * time.Second)})
+	snapshot := mb.Messages()
+
+	deleted := MessageRemoval{Action: RemovalDelete, Time: start.Add(3 * time.Second)}
+	assert.True(t, mb.Delete("2", deleted))
+	assert.False(t, mb.Delete("2", deleted))
+	assert.False(t, mb.Delete("404", deleted))
+
+	// Messages sent after the ban are not purged
+	mb.Insert(&MessageData{ID: "4", UserName: "a", UserID: "10", Message: "after", Time: start.Add(5 * time.Second)})
+	banned := MessageRemoval{Action: RemovalBan, Time: start.Add(4 * time.Second)}
+	assert.Equal(t, 2, mb.Purge("10", banned))
+
+	assert.Equal(t, &deleted, mb.GetByID("2").Removal)
+	assert.Equal(t, "spam", mb.GetByID("2").Message)
+
+	messages := mb.GetByUserName("a", 0)
+	assert.Len(t, messages, 3)
+	assert.Equal(t, RemovalBan, messages[0].Removal.Action)
+	assert.Equal(t, RemovalBan, mb.GetByUserID("10", 0)[1].Removal.Action)
+	assert.False(t, messages[2].IsRemoved())
+
+	assert.Len(t, mb.Removed(time.Time{}, time.Time{}), 3)
+
+	// Snapshots taken before keep the original messages
+	for _, msg := range snapshot {
+		assert.False(t, msg.IsRemoved())
+	}
+}
@@ -0,0 +1,81 @@
+package buffers
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Bytes is a reference counted segment body backed by a pooled buffer. Every
+// holder calls Retain before keeping it and Release once done, the buffer goes
+// back to its pool when the last reference is released.
+type Bytes struct {
+	buf  bytes.Buffer
+	refs atomic.Int32
+	pool *BytePool
+}
+
+type BytePool struct {
+	pool sync.Pool
+}
+
+func NewBytePool() *BytePool {
+	bp := &BytePool{}
+	bp.pool.New = func() any {
+		return &Bytes{pool: bp}
+	}
+
+	return bp
+}
+
+// Get returns an empty Bytes holding a single reference.
+func (bp *BytePool) Get() *Bytes {
+	b := bp.pool.Get().(*Bytes)
+	b.refs.Store(1)
+	return b
+}
+
+// ReadFrom reads r until EOF into the buffer, reusing its capacity.
+func (b *Bytes) ReadFrom(r io.Reader) (int64, error) {
+	return b.buf.ReadFrom(r)
+}
+
+// Grow makes room for another n bytes without reallocating.
+func (b *Bytes) Grow(n int) {
+	b.buf.Grow(n)
+}
+
+// Bytes returns the body without copying it. The slice is only valid until
+// the reference is released.
+func (b *Bytes) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+func (b *Bytes) Len() int {
+	return b.buf.Len()
+}
+
+func (b *Bytes) Retain() *Bytes {
+	b.refs.Add(1)
+	return b
+}
+
+func (b *Bytes) Release() {
+	refs := b.refs.Add(-1)
+	if refs > 0 {
+		return
+	}
+
+	if refs < 0 {
+		panic("buffers: Bytes released more times than retained")
+	}
+
+	// Bytes not taken from a pool are left to the garbage collector
+	if b.pool == nil {
+		return
+	}
+
+	b.buf.Reset()
+	b.pool.pool.Put(b)
+}
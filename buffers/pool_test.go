@@ -0,0 +1,64 @@
+package buffers
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A 2 second segment of a 8 Mbps source rendition
+var benchmarkSegment = bytes.Repeat([]byte{0x47}, 2<<20)
+
+func TestBytesReturnToPoolOnEviction(t *testing.T) {
+	pool := NewBytePool()
+	mb := NewMediaBuffer(4)
+
+	data := pool.Get()
+	data.ReadFrom(bytes.NewReader([]byte("segment")))
+	mb.Insert(&MediaData{SeqId: 1, Data: data, Duration: 2})
+
+	segments := mb.Segments()
+	mb.Insert(&MediaData{SeqId: 2, Data: pool.Get(), Duration: 2})
+	mb.Insert(&MediaData{SeqId: 3, Data: pool.Get(), Duration: 2})
+
+	// Evicted from the buffer, but still readable by the persister
+	assert.False(t, mb.Contains(0, 1))
+	assert.Equal(t, "segment", string(segments[0].Data.Bytes()))
+	assert.Equal(t, int32(1), data.refs.Load())
+
+	ReleaseSegments(segments)
+	assert.Equal(t, int32(0), data.refs.Load())
+	assert.Equal(t, 0, data.Len())
+}
+
+// BenchmarkMediaBufferUnpooled allocates a new buffer for every segment, the
+// baseline for BenchmarkMediaBufferPooled.
+func BenchmarkMediaBufferUnpooled(b *testing.B) {
+	benchmarkMediaBuffer(b, func() *Bytes {
+		data := &Bytes{}
+		data.refs.Store(1)
+		return data
+	})
+}
+
+func BenchmarkMediaBufferPooled(b *testing.B) {
+	pool := NewBytePool()
+	benchmarkMediaBuffer(b, pool.Get)
+}
+
+func benchmarkMediaBuffer(b *testing.B, get func() *Bytes) {
+	mb := NewMediaBuffer(90)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkSegment)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		// Like the HLS client, which knows the Content-Length
+		data := get()
+		data.Grow(len(benchmarkSegment) + bytes.MinRead)
+		data.ReadFrom(bytes.NewReader(benchmarkSegment))
+		mb.Insert(&MediaData{SeqId: uint64(i), Data: data, Duration: 2})
+	}
+}
@@ -0,0 +1,132 @@
+package buffers
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+)
+
+// RetentionView is a named window over a shared MediaStore, e.g. how much
+// video a ban or a highlight wants around it.
+type RetentionView struct {
+	Name     string
+	PreRoll  time.Duration
+	PostRoll time.Duration
+
+	store MediaStore
+}
+
+// Capture captures the view's window around t.
+func (v *RetentionView) Capture(t time.Time) *ClipCapture {
+	return v.store.Capture(t, v.PreRoll, v.PostRoll)
+}
+
+// Before returns the view's pre-roll of video up to t.
+func (v *RetentionView) Before(t time.Time) *Clip {
+	return v.store.Before(t, v.PreRoll)
+}
+
+// Retention keeps several named views over a single MediaStore, so every kind
+// of trigger gets its own window without storing the segments more than once.
+// It is safe for concurrent use.
+type Retention struct {
+	mu sync.RWMutex
+
+	store MediaStore
+	views map[string]*RetentionView
+	// fallback is used for names without a view of their own
+	fallback *RetentionView
+
+	// followers are grown along with store, maxWindow is the largest
+	// window of the views
+	followers []MediaStore
+	maxWindow time.Duration
+}
+
+// NewRetention creates views over store, falling back to a view of preRoll
+// and postRoll for unknown names.
+func NewRetention(store MediaStore, preRoll, postRoll time.Duration) *Retention {
+	r := &Retention{
+		store: store,
+		views: make(map[string]*RetentionView),
+	}
+	r.fallback = r.newView("", preRoll, postRoll)
+
+	return r
+}
+
+// AddView adds or replaces the view called name, growing the store when it
+// does not hold the view's whole window.
+func (r *Retention) AddView(name string, preRoll, postRoll time.Duration) *RetentionView {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	view := r.newView(name, preRoll, postRoll)
+	r.views[name] = view
+
+	return view
+}
+
+// Follow grows store along with the views too, e.g. the buffer of another
+// rendition clipped alongside the views' store.
+func (r *Retention) Follow(store MediaStore) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.followers = append(r.followers, store)
+	grow(store, r.maxWindow)
+}
+
+func (r *Retention) newView(name string, preRoll, postRoll time.Duration) *RetentionView {
+	window := preRoll + postRoll
+	r.maxWindow = max(r.maxWindow, window)
+
+	grow(r.store, window)
+	for _, follower := range r.followers {
+		grow(follower, window)
+	}
+
+	return &RetentionView{
+		Name:     name,
+		PreRoll:  preRoll,
+		PostRoll: postRoll,
+		store:    r.store,
+	}
+}
+
+func grow(store MediaStore, window time.Duration) {
+	if window > store.MaxDuration() {
+		store.SetMaxDuration(window)
+	}
+}
+
+// View returns the view called name, or the fallback view.
+func (r *Retention) View(name string) *RetentionView {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	view, ok := r.views[name]
+	if !ok {
+		return r.fallback
+	}
+
+	return view
+}
+
+// Views returns the views added, without the fallback.
+func (r *Retention) Views() []*RetentionView {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	views := make([]*RetentionView, 0, len(r.views))
+	for _, view := range r.views {
+		views = append(views, view)
+	}
+
+	slices.SortFunc(views, func(a, b *RetentionView) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	return views
+}
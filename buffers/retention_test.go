@@ -0,0 +1,61 @@
+package buffers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetentionViews(t *testing.T) {
+	start := time.Date(2025, 5, 11, 13, 40, 0, 0, time.UTC)
+	mb := NewMediaBuffer(30)
+
+	retention := NewRetention(mb, 10*time.Second, 4*time.Second)
+	retention.AddView("ban", 2*time.Minute, 20*time.Second)
+	retention.AddView("highlight", 30*time.Second, 0)
+
+	// The store grows to the largest view instead of being duplicated
+	assert.Equal(t, 140*time.Second, mb.MaxDuration())
+
+	for i := 0; i < 100; i++ {
+		mb.Insert(&MediaData{SeqId: uint64(i), Duration: 2, ProgramDateTime: start.Add(time.Duration(i) * 2 * time.Second)})
+	}
+
+	at := start.Add(200 * time.Second)
+	tests := []struct {
+		view     string
+		segments int
+	}{
+		{"ban", 60},
+		{"highlight", 15},
+		{"manual", 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.view, func(t *testing.T) {
+			clip := retention.View(tt.view).Before(at)
+			defer clip.Release()
+
+			assert.Len(t, clip.Segments, tt.segments)
+		})
+	}
+
+	assert.Len(t, retention.Views(), 2)
+	assert.Equal(t, "ban", retention.Views()[0].Name)
+}
+
+func TestRetentionFollow(t *testing.T) {
+	mb := NewMediaBuffer(30)
+	preview := NewMediaBuffer(30)
+
+	retention := NewRetention(mb, 10*time.Second, 4*time.Second)
+	retention.AddView("timeout", time.Minute, 20*time.Second)
+
+	// Grown to the views added so far, and to the ones added later
+	retention.Follow(preview)
+	assert.Equal(t, 80*time.Second, preview.MaxDuration())
+
+	retention.AddView("ban", 2*time.Minute, 20*time.Second)
+	assert.Equal(t, 140*time.Second, preview.MaxDuration())
+}
@@ -0,0 +1,248 @@
+package buffers
+
+import (
+	"slices"
+	"time"
+)
+
+// Ring is an ordered window of items, deduplicated by key and evicted from
+// the front once it holds more items, older items or more weight than its
+// limits allow. It is not safe for concurrent use, the buffers built on it do
+// their own locking.
+type Ring[K comparable, T any] struct {
+	// items[head:] are the live items, the front is only compacted once
+	// half of the slice is dead so eviction is amortized O(1)
+	items []T
+	head  int
+	keys  map[K]T
+
+	key  func(item T) K
+	less func(a, b T) bool
+
+	maxCount int
+
+	maxAge time.Duration
+	timeOf func(item T) time.Time
+	latest time.Time
+
+	weights map[string]*ringWeight[T]
+
+	onEvict func(item T)
+}
+
+type ringWeight[T any] struct {
+	max    float64
+	total  float64
+	weight func(item T) float64
+}
+
+// NewRing creates an unbounded ring of items identified by key, kept in
+// insertion order.
+func NewRing[K comparable, T any](key func(item T) K) *Ring[K, T] {
+	return &Ring[K, T]{
+		items:   make([]T, 0),
+		keys:    make(map[K]T),
+		key:     key,
+		weights: make(map[string]*ringWeight[T]),
+	}
+}
+
+// SetLess keeps the items sorted by less instead of by insertion.
+func (r *Ring[K, T]) SetLess(less func(a, b T) bool) {
+	r.less = less
+}
+
+// SetMaxCount limits the number of items. 0 means no limit.
+func (r *Ring[K, T]) SetMaxCount(maxCount int) {
+	r.maxCount = maxCount
+	r.evict()
+}
+
+// SetMaxAge evicts items that are more than maxAge older than the newest item
+// inserted, by timeOf. 0 means no limit.
+func (r *Ring[K, T]) SetMaxAge(maxAge time.Duration, timeOf func(item T) time.Time) {
+	r.maxAge = maxAge
+	r.timeOf = timeOf
+	r.evict()
+}
+
+// SetMaxWeight limits the total of a named weight, e.g. the duration or size
+// of the items. weight must not change while an item is in the ring. A max of
+// 0 only keeps the total.
+func (r *Ring[K, T]) SetMaxWeight(name string, max float64, weight func(item T) float64) {
+	w, ok := r.weights[name]
+	if !ok {
+		w = &ringWeight[T]{}
+		for _, item := range r.Items() {
+			w.total += weight(item)
+		}
+		r.weights[name] = w
+	}
+
+	w.max = max
+	w.weight = weight
+	r.evict()
+}
+
+// OnEvict is called with every item leaving the ring, but not with rejected
+// duplicates.
+func (r *Ring[K, T]) OnEvict(callback func(item T)) {
+	r.onEvict = callback
+}
+
+// Insert adds item unless an item with the same key is in the ring, and then
+// evicts what went over the limits, possibly item itself. It reports whether
+// item was added.
+func (r *Ring[K, T]) Insert(item T) bool {
+	key := r.key(item)
+	if _, ok := r.keys[key]; ok {
+		return false
+	}
+
+	pos := len(r.items)
+	if r.less != nil {
+		// Items mostly arrive in order, so look from the back
+		for pos > r.head && r.less(item, r.items[pos-1]) {
+			pos--
+		}
+	}
+
+	r.items = slices.Insert(r.items, pos, item)
+	r.keys[key] = item
+
+	for _, w := range r.weights {
+		w.total += w.weight(item)
+	}
+
+	if r.timeOf != nil && r.timeOf(item).After(r.latest) {
+		r.latest = r.timeOf(item)
+	}
+
+	r.evict()
+	return true
+}
+
+func (r *Ring[K, T]) evict() {
+	for r.Len() > 0 && r.overLimit(r.items[r.head]) {
+		r.evictFront()
+	}
+
+	if r.head > 0 && r.head >= len(r.items)/2 {
+		n := copy(r.items, r.items[r.head:])
+		clear(r.items[n:])
+		r.items = r.items[:n]
+		r.head = 0
+	}
+}
+
+func (r *Ring[K, T]) overLimit(front T) bool {
+	if r.maxCount > 0 && r.Len() > r.maxCount {
+		return true
+	}
+
+	if r.maxAge > 0 && r.timeOf != nil && r.latest.Sub(r.timeOf(front)) > r.maxAge {
+		return true
+	}
+
+	for _, w := range r.weights {
+		if w.max > 0 && w.total > w.max {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Ring[K, T]) evictFront() {
+	var zero T
+	item := r.items[r.head]
+	r.items[r.head] = zero
+	r.head++
+
+	delete(r.keys, r.key(item))
+	for _, w := range r.weights {
+		w.total -= w.weight(item)
+	}
+
+	if r.onEvict != nil {
+		r.onEvict(item)
+	}
+}
+
+// Replace puts item in place of the item with the same key, in place. It must
+// keep the order and weights of the one it replaces. It reports whether there
+// was one to replace.
+func (r *Ring[K, T]) Replace(item T) bool {
+	key := r.key(item)
+	if _, ok := r.keys[key]; !ok {
+		return false
+	}
+
+	// Recent items are replaced the most, so look from the back
+	for i := len(r.items) - 1; i >= r.head; i-- {
+		if r.key(r.items[i]) == key {
+			r.items[i] = item
+			r.keys[key] = item
+			return true
+		}
+	}
+
+	return false
+}
+
+// Contains reports whether an item with key is in the ring.
+func (r *Ring[K, T]) Contains(key K) bool {
+	_, ok := r.keys[key]
+	return ok
+}
+
+// Get returns the item with key.
+func (r *Ring[K, T]) Get(key K) (T, bool) {
+	item, ok := r.keys[key]
+	return item, ok
+}
+
+func (r *Ring[K, T]) Len() int {
+	return len(r.items) - r.head
+}
+
+// Items returns the items in order. The slice is only valid until the ring is
+// modified.
+func (r *Ring[K, T]) Items() []T {
+	return r.items[r.head:]
+}
+
+// Weight returns the total of the named weight.
+func (r *Ring[K, T]) Weight(name string) float64 {
+	w, ok := r.weights[name]
+	if !ok {
+		return 0
+	}
+
+	return w.total
+}
+
+// MaxWeight returns the limit of the named weight.
+func (r *Ring[K, T]) MaxWeight(name string) float64 {
+	w, ok := r.weights[name]
+	if !ok {
+		return 0
+	}
+
+	return w.max
+}
+
+// Clear evicts all items.
+func (r *Ring[K, T]) Clear() {
+	for r.Len() > 0 {
+		r.evictFront()
+	}
+
+	clear(r.items)
+	r.items = r.items[:0]
+	r.head = 0
+	r.latest = time.Time{}
+	for _, w := range r.weights {
+		w.total = 0
+	}
+}
@@ -0,0 +1,117 @@
+package buffers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ringItem struct {
+	id     int
+	time   time.Time
+	weight float64
+}
+
+func newTestRing() *Ring[int, ringItem] {
+	return NewRing(func(item ringItem) int { return item.id })
+}
+
+func ringIDs(r *Ring[int, ringItem]) []int {
+	ids := make([]int, 0, r.Len())
+	for _, item := range r.Items() {
+		ids = append(ids, item.id)
+	}
+
+	return ids
+}
+
+func TestRingOrderedInsert(t *testing.T) {
+	r := newTestRing()
+	r.SetLess(func(a, b ringItem) bool { return a.id < b.id })
+
+	for _, id := range []int{2, 4, 1, 3, 4} {
+		r.Insert(ringItem{id: id})
+	}
+
+	assert.Equal(t, []int{1, 2, 3, 4}, ringIDs(r))
+	assert.True(t, r.Contains(3))
+	assert.False(t, r.Insert(ringItem{id: 2}))
+}
+
+func TestRingLimits(t *testing.T) {
+	start := time.Now()
+
+	tests := []struct {
+		name  string
+		setup func(r *Ring[int, ringItem])
+		want  []int
+	}{
+		{
+			name:  "count",
+			setup: func(r *Ring[int, ringItem]) { r.SetMaxCount(3) },
+			want:  []int{3, 4, 5},
+		},
+		{
+			name: "age",
+			setup: func(r *Ring[int, ringItem]) {
+				r.SetMaxAge(2*time.Second, func(item ringItem) time.Time { return item.time })
+			},
+			want: []int{3, 4, 5},
+		},
+		{
+			name: "weight",
+			setup: func(r *Ring[int, ringItem]) {
+				r.SetMaxWeight("weight", 5, func(item ringItem) float64 { return item.weight })
+			},
+			want: []int{4, 5},
+		},
+		{
+			name: "independent",
+			setup: func(r *Ring[int, ringItem]) {
+				r.SetMaxCount(4)
+				r.SetMaxAge(10*time.Second, func(item ringItem) time.Time { return item.time })
+			},
+			want: []int{2, 3, 4, 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRing()
+			tt.setup(r)
+
+			evicted := make([]int, 0)
+			r.OnEvict(func(item ringItem) { evicted = append(evicted, item.id) })
+
+			for id := 1; id <= 5; id++ {
+				r.Insert(ringItem{id: id, time: start.Add(time.Duration(id) * time.Second), weight: float64(id) / 2})
+			}
+
+			assert.Equal(t, tt.want, ringIDs(r))
+			assert.Equal(t, 5-len(tt.want), len(evicted))
+
+			r.Clear()
+			assert.Equal(t, 0, r.Len())
+			assert.Len(t, evicted, 5)
+			assert.Zero(t, r.Weight("weight"))
+		})
+	}
+}
+
+func TestRingReplace(t *testing.T) {
+	r := newTestRing()
+	r.SetMaxCount(3)
+	for id := 1; id <= 4; id++ {
+		r.Insert(ringItem{id: id})
+	}
+
+	assert.True(t, r.Replace(ringItem{id: 3, weight: 1}))
+	assert.False(t, r.Replace(ringItem{id: 1, weight: 1}))
+
+	item, ok := r.Get(3)
+	assert.True(t, ok)
+	assert.Equal(t, 1.0, item.weight)
+	assert.Equal(t, []int{2, 3, 4}, ringIDs(r))
+	assert.Equal(t, 1.0, r.Items()[1].weight)
+}
@@ -0,0 +1,267 @@
+package buffers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const snapshotIndex = "index.ndjson"
+
+// snapshotPool backs the segments restored from a snapshot into memory.
+var snapshotPool = NewBytePool()
+
+// segmentEntry is a single line of the index of a media snapshot.
+type segmentEntry struct {
+	Epoch           uint64    `json:"epoch"`
+	SeqId           uint64    `json:"seqId"`
+	Duration        float64   `json:"duration"`
+	ProgramDateTime time.Time `json:"programDateTime"`
+	File            string    `json:"file"`
+}
+
+// Snapshot writes the buffered segments to dir, replacing any snapshot already
+// there, so they can be restored with Restore after a restart. Segments kept
+// on disk are hard linked when possible instead of copied.
+func (mb *MediaBuffer) Snapshot(dir string) error {
+	segments := mb.Segments()
+	defer ReleaseSegments(segments)
+
+	err := os.RemoveAll(dir)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	entries := make([]segmentEntry, 0, len(segments))
+	for _, segment := range segments {
+		name := fmt.Sprintf("%d-%d.ts", segment.Epoch, segment.SeqId)
+
+		err := snapshotSegment(segment, filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, segmentEntry{
+			Epoch:           segment.Epoch,
+			SeqId:           segment.SeqId,
+			Duration:        segment.Duration,
+			ProgramDateTime: segment.ProgramDateTime,
+			File:            name,
+		})
+	}
+
+	// The index is written last, so a snapshot without one is incomplete
+	return writeNDJSON(filepath.Join(dir, snapshotIndex), entries)
+}
+
+func snapshotSegment(segment *MediaData, path string) error {
+	if segment.file != nil && os.Link(segment.file.path, path) == nil {
+		return nil
+	}
+
+	body, err := segment.Open()
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Restore inserts the segments of the snapshot in dir that are still inside
+// the buffer's window, and removes the snapshot. A missing snapshot is not an
+// error. The restored epochs are renumbered from 0, so the stream has to go on
+// from the epoch after the newest one.
+func (mb *MediaBuffer) Restore(dir string) error {
+	return restoreSegments(dir, mb.MaxDuration(), mb.Insert)
+}
+
+// Restore is like MediaBuffer.Restore, but spills the restored segments to
+// disk again.
+func (db *DiskMediaBuffer) Restore(dir string) error {
+	return restoreSegments(dir, db.MaxDuration(), db.Insert)
+}
+
+func restoreSegments(dir string, maxAge time.Duration, insert func(segment *MediaData)) error {
+	var entries []segmentEntry
+	err := readNDJSON(filepath.Join(dir, snapshotIndex), &entries)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	segments := make([]*MediaData, 0, len(entries))
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		segment := &MediaData{
+			Epoch:           entry.Epoch,
+			SeqId:           entry.SeqId,
+			Duration:        entry.Duration,
+			ProgramDateTime: entry.ProgramDateTime,
+		}
+
+		if segment.ProgramDateTime.IsZero() || !segment.end().After(cutoff) {
+			continue
+		}
+
+		segments = append(segments, segment)
+		files = append(files, entry.File)
+	}
+
+	// Epochs are numbered per process, so the restored ones are renumbered
+	// from 0 and the stream's epochs have to start after them
+	renumberEpochs(segments)
+
+	for i, segment := range segments {
+		f, err := os.Open(filepath.Join(dir, files[i]))
+		if err != nil {
+			return err
+		}
+
+		segment.Data = snapshotPool.Get()
+		_, err = segment.Data.ReadFrom(f)
+		f.Close()
+		if err != nil {
+			segment.Data.Release()
+			return err
+		}
+
+		insert(segment)
+	}
+
+	return os.RemoveAll(dir)
+}
+
+// renumberEpochs numbers the epochs of segments, which must be ordered,
+// from 0 on.
+func renumberEpochs(segments []*MediaData) {
+	var epoch, previous uint64
+	for i, segment := range segments {
+		if i > 0 && segment.Epoch != previous {
+			epoch++
+		}
+
+		previous = segment.Epoch
+		segment.Epoch = epoch
+	}
+}
+
+// Snapshot writes the buffered messages to path, so they can be restored with
+// Restore after a restart.
+func (mb *MessagesBuffer) Snapshot(path string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	return writeNDJSON(path, mb.Messages())
+}
+
+// Restore inserts the messages of the snapshot at path that are still inside
+// the buffer's window, and removes the snapshot. A missing snapshot is not an
+// error.
+func (mb *MessagesBuffer) Restore(path string) error {
+	var messages []*MessageData
+	err := readNDJSON(path, &messages)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-mb.maxTimeDiff)
+	for _, msg := range messages {
+		if msg.Time.Before(cutoff) {
+			continue
+		}
+
+		mb.Insert(msg)
+	}
+
+	return os.Remove(path)
+}
+
+// writeNDJSON writes values to path as one JSON object per line, atomically
+// replacing the file.
+func writeNDJSON[T any](path string, values []T) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	encoder := json.NewEncoder(w)
+	for _, value := range values {
+		err = encoder.Encode(value)
+		if err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		err = w.Flush()
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+	}
+
+	return err
+}
+
+func readNDJSON[T any](path string, values *[]T) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	for {
+		var value T
+		err := decoder.Decode(&value)
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		*values = append(*values, value)
+	}
+}
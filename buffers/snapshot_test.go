@@ -0,0 +1,76 @@
+package buffers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMediaBufferSnapshotRestore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "media")
+	pool := NewBytePool()
+	now := time.Now()
+
+	db, err := NewDiskMediaBuffer(t.TempDir(), 10)
+	assert.NoError(t, err)
+
+	insert := func(epoch, seqId uint64, pdt time.Time) {
+		data := pool.Get()
+		data.ReadFrom(bytes.NewReader([]byte(fmt.Sprintf("segment %d;", seqId))))
+		db.Insert(&MediaData{Epoch: epoch, SeqId: seqId, Data: data, Duration: 2, ProgramDateTime: pdt})
+	}
+
+	// 1 fell out of the window during the restart, 2 is of an older epoch
+	insert(0, 1, now.Add(-20*time.Second))
+	insert(1, 2, now.Add(-8*time.Second))
+	insert(3, 3, now.Add(-6*time.Second))
+	insert(3, 4, now.Add(-4*time.Second))
+
+	assert.NoError(t, db.Snapshot(dir))
+	db.Clear()
+
+	mb := NewMediaBuffer(10)
+	assert.NoError(t, mb.Restore(dir))
+
+	segments := mb.Segments()
+	defer ReleaseSegments(segments)
+
+	// Renumbered from 0, so the epochs of the new run sort after them
+	assert.Len(t, segments, 3)
+	assert.Equal(t, []uint64{0, 1, 1}, []uint64{segments[0].Epoch, segments[1].Epoch, segments[2].Epoch})
+	assert.Equal(t, uint64(3), segments[1].SeqId)
+	assert.True(t, segments[1].ProgramDateTime.Equal(now.Add(-6*time.Second)))
+
+	body, err := io.ReadAll(SegmentsReader(segments))
+	assert.NoError(t, err)
+	assert.Equal(t, "segment 2;segment 3;segment 4;", string(body))
+
+	// The snapshot is consumed
+	assert.NoError(t, mb.Restore(dir))
+	assert.Equal(t, 3, mb.Stats().Segments)
+}
+
+func TestMessagesBufferSnapshotRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.ndjson")
+	now := time.Now()
+
+	mb := NewMessagesBuffer(600)
+	mb.Insert(&MessageData{ID: "1", UserName: "a", Message: "old", Time: now.Add(-11 * time.Minute)})
+	mb.Insert(&MessageData{ID: "2", UserName: "a", UserID: "1", Message: "recent", Time: now.Add(-2 * time.Minute), Badges: map[string]int{"subscriber": 12}})
+
+	assert.NoError(t, mb.Snapshot(path))
+
+	restored := NewMessagesBuffer(600)
+	assert.NoError(t, restored.Restore(path))
+
+	messages := restored.GetByUserID("1", 0)
+	assert.Len(t, restored.Messages(), 1)
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "recent", messages[0].Message)
+	assert.True(t, messages[0].IsSubscriber())
+}
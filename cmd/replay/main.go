@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"sync"
+
+	"go-gryps/hls"
+)
+
+func main() {
+	dir := flag.String("dir", "", "Directory with a recording made with -hls-record-dir")
+	speed := flag.Float64("speed", 1, "Replay speed, 1 replays at original timing")
+	out := flag.String("out", "replay.ts", "File to write the replayed segments to")
+	flag.Parse()
+
+	replay, err := hls.NewReplay(*dir, *speed)
+	if err != nil {
+		log.Fatalf("Unable to open recording: %v", err)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatalf("Unable to create output file: %v", err)
+	}
+	defer f.Close()
+
+	client := hls.NewTwitchHLSClient()
+
+	// Segments of a single playlist are fetched concurrently
+	var mu sync.Mutex
+
+	client.OnMediaSegmentWithBytes(func(media hls.MediaSegmentWithBytes) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		log.Printf("segment epoch=%d seq=%d bytes=%d", media.Epoch, media.MediaSegment.SeqId, media.Bytes.Len())
+		f.Write(media.Bytes.Bytes())
+	})
+
+	client.OnRenditionChange(func(change hls.RenditionChange) {
+		log.Printf("rendition changed from %s to %s", change.From.Name, change.To.Name)
+	})
+
+	client.OnStall(func() {
+		log.Printf("media playlist stalled")
+	})
+
+	err = client.Replay(context.Background(), replay)
+	if err != nil && !errors.Is(err, hls.ErrEndOfRecording) {
+		log.Fatalf("Replay failed: %v", err)
+	}
+}
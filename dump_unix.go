@@ -0,0 +1,26 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// dumpOnSignal dumps the buffers to a new directory every time the process
+// gets SIGUSR1, for incidents no moderation event caught.
+func (app *application) dumpOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+
+	for range signals {
+		dir, err := app.dump()
+		if err != nil {
+			app.logger.Error("Failed to dump buffers", "err", err)
+			continue
+		}
+
+		app.logger.Info("Dumped buffers", "dir", dir)
+	}
+}
@@ -0,0 +1,4 @@
+package main
+
+// dumpOnSignal does nothing, Windows has no SIGUSR1 to ask for a dump with.
+func (app *application) dumpOnSignal() {}
@@ -1,78 +1,331 @@
 package hls
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"maps"
 	"slices"
 	"sync"
 	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/grafov/m3u8"
+
+	"go-gryps/buffers"
 )
 
+// ErrStalled is returned by Run when the media playlist stops advancing
+// without being closed, e.g. when the edge node got wedged or the token was
+// silently invalidated.
+var ErrStalled = errors.New("hls: media playlist stalled")
+
+// defaultStallTargetDurations is how many target durations the media playlist
+// may go without a new SeqId before it is considered stalled. A request taking
+// as long is given up on too, as a wedged edge may not answer at all.
+const defaultStallTargetDurations = 3
+
+// defaultTargetDuration bounds the requests until the first media playlist
+// tells the actual target duration.
+const defaultTargetDuration = 6 * time.Second
+
 type hlsClient struct {
 	MasterPlaylistURI string
-	lastSegments      []*m3u8.MediaSegment
-	restyClient       *resty.Client
+	lastSegments      map[string][]*m3u8.MediaSegment
+	lastSeqId         uint64
+	source            source
+	clock             clock
+	bytePool          *buffers.BytePool
+	latency           *latencyTracker
+
+	// epoch is bumped whenever the media sequence resets or the broadcast ID
+	// changes, so segments can be ordered across encoder restarts.
+	epoch       uint64
+	broadcastID string
+	// firstSeqId is the first SeqId of the newest media playlist, anything
+	// ending before it is a new epoch
+	firstSeqId uint64
+
+	lastDateRanges map[string]DateRange
+
+	stallTargetDurations int
+
+	// extraRenditions are captured alongside the source rendition, keyed by
+	// the rendition key their segments are delivered with
+	extraRenditions map[string]string
 
 	onMediaSegmentWithBytes func(mediaSegmentWithBytes MediaSegmentWithBytes)
+	onRenditionChange       func(renditionChange RenditionChange)
+	onDateRange             func(dateRange DateRange)
 }
 
+// MediaSegmentWithBytes is only valid during the OnMediaSegmentWithBytes
+// callback, Bytes has to be retained to keep it any longer.
 type MediaSegmentWithBytes struct {
 	MediaSegment *m3u8.MediaSegment
-	Bytes        *[]byte
+	Bytes        *buffers.Bytes
+	Epoch        uint64
+	BroadcastID  string
+	// Rendition is SourceRendition or the key of an extra rendition
+	Rendition string
 }
 
 func newHlsClient() *hlsClient {
 	restyClient := resty.New()
 
 	return &hlsClient{
-		lastSegments: make([]*m3u8.MediaSegment, 0),
-		restyClient:  restyClient,
+		lastSegments:         make(map[string][]*m3u8.MediaSegment),
+		source:               &httpSource{restyClient: restyClient},
+		clock:                realClock{},
+		bytePool:             buffers.NewBytePool(),
+		latency:              newLatencyTracker(),
+		stallTargetDurations: defaultStallTargetDurations,
 	}
 }
 
 func (hls *hlsClient) Run(ctx context.Context) error {
-	masterPlaylist, err := hls.getMasterPlaylist(hls.MasterPlaylistURI)
+	targetDuration := defaultTargetDuration
+
+	sentAt := hls.clock.Now()
+	requestCtx, cancel := hls.requestContext(ctx, targetDuration)
+	masterPlaylist, err := hls.getMasterPlaylist(requestCtx, hls.MasterPlaylistURI)
+	cancel()
 	if err != nil {
-		return err
+		return requestError(ctx, requestCtx, err)
 	}
+	fetchedAt := midpoint(sentAt, hls.clock.Now())
 
-	//TODO: I hope Variants[0] is the best quality
-	masterPlaylistURI := masterPlaylist.Variants[0].URI
+	info := twitchInfo(masterPlaylist)
+	hls.latency.syncClock(info, fetchedAt)
+
+	renditions := newAdaptiveRendition(masterPlaylist.Variants)
+	if len(renditions.variants) == 0 {
+		return errors.New("hls: master playlist has no video variants")
+	}
+
+	broadcastID := info["BROADCAST-ID"]
+	if broadcastID != "" {
+		if hls.broadcastID != "" && broadcastID != hls.broadcastID {
+			hls.nextEpoch()
+		}
+		hls.broadcastID = broadcastID
+	}
+
+	lastProgress := hls.clock.Now()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
 		default:
-			mediaPlaylist, err := hls.getMediaPlaylist(masterPlaylistURI)
+			sentAt := hls.clock.Now()
+			requestCtx, cancel := hls.requestContext(ctx, targetDuration)
+			mediaPlaylist, dateRanges, err := hls.getMediaPlaylist(requestCtx, renditions.variant().URI)
+			cancel()
 			if err != nil {
-				return err
+				return requestError(ctx, requestCtx, err)
 			}
+			fetchedAt := midpoint(sentAt, hls.clock.Now())
+
+			hls.notifyDateRanges(dateRanges)
+
+			hls.latency.observe(mediaPlaylist.Segments, fetchedAt)
+			fillProgramDateTimes(mediaPlaylist.Segments, fetchedAt)
 
 			if mediaPlaylist.Closed {
 				return nil
 			}
 
-			hls.getPlaylistSegments(mediaPlaylist.Segments)
+			if mediaPlaylist.TargetDuration > 0 {
+				targetDuration = time.Duration(mediaPlaylist.TargetDuration * float64(time.Second))
+			}
+
+			// Segments up to the previous live edge were delivered already,
+			// even when a lagging edge lists them again after a reconnect
+			epoch, delivered := hls.epoch, hls.lastSeqId
+
+			if hls.advanceSequence(mediaPlaylist.Segments) {
+				lastProgress = hls.clock.Now()
+			} else if hls.clock.Now().Sub(lastProgress) > time.Duration(hls.stallTargetDurations)*targetDuration {
+				return ErrStalled
+			}
+
+			if hls.epoch != epoch {
+				delivered = 0
+			}
+
+			// Segment downloads running too long only leave gaps, the stall
+			// watchdog is about the playlist
+			requestCtx, cancel = hls.requestContext(ctx, targetDuration)
+			load, ok := hls.getPlaylistSegments(requestCtx, SourceRendition, mediaPlaylist.Segments, delivered)
+			if ok {
+				previous := renditions.variant()
+				if renditions.update(load) && hls.onRenditionChange != nil {
+					hls.onRenditionChange(RenditionChange{
+						From: newRendition(previous),
+						To:   newRendition(renditions.variant()),
+					})
+				}
+			}
+
+			for key, name := range hls.extraRenditions {
+				// Extra renditions are not fatal, the source one is what matters
+				extraPlaylist, _, err := hls.getMediaPlaylist(requestCtx, renditions.find(name).URI)
+				if err != nil {
+					continue
+				}
+
+				fillProgramDateTimes(extraPlaylist.Segments, hls.clock.Now())
+				hls.getPlaylistSegments(requestCtx, key, alignSegments(extraPlaylist.Segments, mediaPlaylist.Segments), delivered)
+			}
+			cancel()
 
 			// TODO: this is not accurate
-			time.Sleep(time.Duration(mediaPlaylist.TargetDuration) * time.Second)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-hls.clock.After(targetDuration):
+			}
+		}
+	}
+}
+
+// advanceSequence follows the media sequence with a new media playlist and
+// reports whether it brought new segments. A playlist ending before the
+// previous one began means the encoder restarted and the sequence started
+// over, so a new epoch is started. One merely lagging behind, e.g. from another
+// edge after a reconnect, still overlaps it and is not a restart.
+func (hls *hlsClient) advanceSequence(playlistSegments []*m3u8.MediaSegment) bool {
+	first, ok := firstSeqId(playlistSegments)
+	if !ok {
+		return false
+	}
+
+	last, _ := lastSeqId(playlistSegments)
+	if hls.lastSeqId > 0 && last < hls.firstSeqId {
+		hls.nextEpoch()
+	}
+
+	if last <= hls.lastSeqId {
+		return false
+	}
+
+	hls.firstSeqId = first
+	hls.lastSeqId = last
+	return true
+}
+
+func (hls *hlsClient) nextEpoch() {
+	hls.epoch++
+	hls.firstSeqId = 0
+	hls.lastSeqId = 0
+	hls.lastSegments = make(map[string][]*m3u8.MediaSegment)
+}
+
+// fillProgramDateTimes estimates the EXT-X-PROGRAM-DATE-TIME of segments
+// lacking it from their neighbours or, when the playlist has none at all, as if
+// the last segment ended at fetchedAt.
+func fillProgramDateTimes(playlistSegments []*m3u8.MediaSegment, fetchedAt time.Time) {
+	n := 0
+	for n < len(playlistSegments) && playlistSegments[n] != nil {
+		n++
+	}
+
+	if n == 0 {
+		return
+	}
+
+	duration := func(segment *m3u8.MediaSegment) time.Duration {
+		return time.Duration(segment.Duration * float64(time.Second))
+	}
+
+	for i := 1; i < n; i++ {
+		previous, segment := playlistSegments[i-1], playlistSegments[i]
+		if segment.ProgramDateTime.IsZero() && !previous.ProgramDateTime.IsZero() {
+			segment.ProgramDateTime = previous.ProgramDateTime.Add(duration(previous))
+		}
+	}
+
+	if last := playlistSegments[n-1]; last.ProgramDateTime.IsZero() {
+		last.ProgramDateTime = fetchedAt.Add(-duration(last))
+	}
+
+	for i := n - 2; i >= 0; i-- {
+		segment, next := playlistSegments[i], playlistSegments[i+1]
+		if segment.ProgramDateTime.IsZero() {
+			segment.ProgramDateTime = next.ProgramDateTime.Add(-duration(segment))
 		}
 	}
 }
 
-func (hls *hlsClient) getMasterPlaylist(URI string) (*m3u8.MasterPlaylist, error) {
-	resp, err := hls.restyClient.R().SetDoNotParseResponse(true).Get(URI)
+// alignSegments drops the segments newer than the last one of the source
+// rendition, so every rendition covers the same range. Twitch numbers the
+// segments of all variants the same way. Nothing is dropped while the source
+// playlist is empty.
+func alignSegments(playlistSegments, sourceSegments []*m3u8.MediaSegment) []*m3u8.MediaSegment {
+	maxSeqId, ok := lastSeqId(sourceSegments)
+	if !ok {
+		return playlistSegments
+	}
+
+	for i, segment := range playlistSegments {
+		if segment == nil || segment.SeqId > maxSeqId {
+			return playlistSegments[:i]
+		}
+	}
+
+	return playlistSegments
+}
+
+func firstSeqId(playlistSegments []*m3u8.MediaSegment) (uint64, bool) {
+	if len(playlistSegments) == 0 || playlistSegments[0] == nil {
+		return 0, false
+	}
+
+	return playlistSegments[0].SeqId, true
+}
+
+func lastSeqId(playlistSegments []*m3u8.MediaSegment) (uint64, bool) {
+	for i := len(playlistSegments) - 1; i >= 0; i-- {
+		if playlistSegments[i] != nil {
+			return playlistSegments[i].SeqId, true
+		}
+	}
+
+	return 0, false
+}
+
+// requestContext bounds a request by as long as the media playlist may go
+// without progress.
+func (hls *hlsClient) requestContext(ctx context.Context, targetDuration time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, time.Duration(hls.stallTargetDurations)*targetDuration)
+}
+
+// requestError turns a request that timed out into ErrStalled, and one
+// cancelled along with the capture into no error at all.
+func requestError(ctx, requestCtx context.Context, err error) error {
+	switch {
+	case ctx.Err() != nil:
+		return nil
+	case errors.Is(requestCtx.Err(), context.DeadlineExceeded):
+		return ErrStalled
+	default:
+		return err
+	}
+}
+
+func (hls *hlsClient) getMasterPlaylist(ctx context.Context, URI string) (*m3u8.MasterPlaylist, error) {
+	rawBody, _, err := hls.source.open(ctx, masterPlaylistKind, URI)
 	if err != nil {
 		return nil, err
 	}
-
-	rawBody := resp.RawBody()
 	defer rawBody.Close()
 
-	playlist, _, err := m3u8.DecodeFrom(rawBody, true)
+	customDecoders := []m3u8.CustomDecoder{
+		&attributeListDecoder{name: twitchInfoTag},
+	}
+
+	playlist, _, err := m3u8.DecodeWith(rawBody, true, customDecoders)
 	if err != nil {
 		return nil, err
 	}
@@ -81,50 +334,96 @@ func (hls *hlsClient) getMasterPlaylist(URI string) (*m3u8.MasterPlaylist, error
 	return masterPlaylist, nil
 }
 
-func (hls *hlsClient) getMediaPlaylist(masterPlaylistURI string) (*m3u8.MediaPlaylist, error) {
-	resp, err := hls.restyClient.R().SetDoNotParseResponse(true).Get(masterPlaylistURI)
+func (hls *hlsClient) getMediaPlaylist(ctx context.Context, mediaPlaylistURI string) (*m3u8.MediaPlaylist, []DateRange, error) {
+	rawBody, _, err := hls.source.open(ctx, mediaPlaylistKind, mediaPlaylistURI)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-
-	rawBody := resp.RawBody()
 	defer rawBody.Close()
 
-	playlist, _, err := m3u8.DecodeFrom(rawBody, true)
+	dateRangeDecoder := &attributeListDecoder{name: dateRangeTag}
+	customDecoders := []m3u8.CustomDecoder{dateRangeDecoder}
+
+	playlist, _, err := m3u8.DecodeWith(rawBody, true, customDecoders)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	dateRanges := make([]DateRange, len(dateRangeDecoder.decoded))
+	for i, tag := range dateRangeDecoder.decoded {
+		dateRanges[i] = newDateRange(tag)
 	}
 
 	mediaPlaylist := playlist.(*m3u8.MediaPlaylist)
-	return mediaPlaylist, nil
+	return mediaPlaylist, dateRanges, nil
+}
+
+// notifyDateRanges delivers the date ranges that are new or were updated
+// since the previous media playlist.
+func (hls *hlsClient) notifyDateRanges(dateRanges []DateRange) {
+	seen := make(map[string]DateRange, len(dateRanges))
+
+	for _, dateRange := range dateRanges {
+		seen[dateRange.ID] = dateRange
+
+		last, ok := hls.lastDateRanges[dateRange.ID]
+		if ok && maps.Equal(last.Attributes, dateRange.Attributes) {
+			continue
+		}
+
+		if hls.onDateRange != nil {
+			hls.onDateRange(dateRange)
+		}
+	}
+
+	hls.lastDateRanges = seen
 }
 
-func (hls *hlsClient) getPlaylistSegments(playlistSegments []*m3u8.MediaSegment) {
+// getPlaylistSegments downloads the segments that were neither in the previous
+// playlist nor up to the delivered SeqId, 0 for none, and returns the load,
+// i.e. how long the downloads took compared to the duration of the downloaded
+// media. ok is false when nothing was downloaded.
+func (hls *hlsClient) getPlaylistSegments(ctx context.Context, rendition string, playlistSegments []*m3u8.MediaSegment, delivered uint64) (load float64, ok bool) {
 	var wg sync.WaitGroup
 
+	epoch, broadcastID := hls.epoch, hls.broadcastID
+
+	start := time.Now()
+	duration := 0.0
+
 	for i, playlistSegment := range playlistSegments {
 		if playlistSegment == nil {
 			break
 		}
 
-		if slices.ContainsFunc(hls.lastSegments, func(segment *m3u8.MediaSegment) bool {
+		if delivered > 0 && playlistSegment.SeqId <= delivered {
+			continue
+		}
+
+		if slices.ContainsFunc(hls.lastSegments[rendition], func(segment *m3u8.MediaSegment) bool {
 			return segment != nil && segment.SeqId == playlistSegment.SeqId
 		}) {
 			continue
 		}
 
+		duration += playlistSegment.Duration
+
 		wg.Add(1)
 		go func(i int, playlistSegment *m3u8.MediaSegment) {
 			defer wg.Done()
 
-			data, err := hls.getMediaSegmentURI(playlistSegment.URI)
+			data, err := hls.getMediaSegmentURI(ctx, playlistSegment.URI)
 			if err != nil {
 				return
 			}
+			defer data.Release()
 
 			mediaData := MediaSegmentWithBytes{
 				MediaSegment: playlistSegment,
-				Bytes:        &data,
+				Bytes:        data,
+				Epoch:        epoch,
+				BroadcastID:  broadcastID,
+				Rendition:    rendition,
 			}
 
 			if hls.onMediaSegmentWithBytes != nil {
@@ -135,14 +434,33 @@ func (hls *hlsClient) getPlaylistSegments(playlistSegments []*m3u8.MediaSegment)
 	}
 
 	wg.Wait()
-	hls.lastSegments = playlistSegments
+	hls.lastSegments[rendition] = playlistSegments
+
+	if duration == 0 {
+		return 0, false
+	}
+
+	return time.Since(start).Seconds() / duration, true
 }
 
-func (hls *hlsClient) getMediaSegmentURI(segmentURI string) ([]byte, error) {
-	response, err := hls.restyClient.R().Get(segmentURI)
+func (hls *hlsClient) getMediaSegmentURI(ctx context.Context, segmentURI string) (*buffers.Bytes, error) {
+	rawBody, size, err := hls.source.open(ctx, segmentKind, segmentURI)
+	if err != nil {
+		return nil, err
+	}
+	defer rawBody.Close()
+
+	data := hls.bytePool.Get()
+	if size > 0 {
+		// ReadFrom wants MinRead spare bytes even when the body fits exactly
+		data.Grow(int(size) + bytes.MinRead)
+	}
+
+	_, err = data.ReadFrom(rawBody)
 	if err != nil {
+		data.Release()
 		return nil, err
 	}
 
-	return response.Body(), err
+	return data, nil
 }
@@ -0,0 +1,219 @@
+package hls
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafov/m3u8"
+	"github.com/stretchr/testify/assert"
+)
+
+func playlistSegments(from, to uint64) []*m3u8.MediaSegment {
+	segments := make([]*m3u8.MediaSegment, 0, to-from+1)
+	for seqId := from; seqId <= to; seqId++ {
+		segments = append(segments, &m3u8.MediaSegment{SeqId: seqId, Duration: 2})
+	}
+
+	// Like m3u8, leave room at the end
+	return append(segments, nil, nil)
+}
+
+func TestAdvanceSequence(t *testing.T) {
+	hls := newHlsClient()
+	hls.lastSegments[SourceRendition] = playlistSegments(10, 15)
+
+	tests := []struct {
+		name     string
+		from, to uint64
+		progress bool
+		epoch    uint64
+		last     uint64
+	}{
+		{name: "first playlist", from: 10, to: 15, progress: true, epoch: 0, last: 15},
+		{name: "unchanged", from: 10, to: 15, progress: false, epoch: 0, last: 15},
+		{name: "lagging edge", from: 9, to: 14, progress: false, epoch: 0, last: 15},
+		{name: "caught up", from: 11, to: 16, progress: true, epoch: 0, last: 16},
+		{name: "encoder restart", from: 0, to: 3, progress: true, epoch: 1, last: 3},
+		{name: "after restart", from: 1, to: 4, progress: true, epoch: 1, last: 4},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.progress, hls.advanceSequence(playlistSegments(tt.from, tt.to)), tt.name)
+		assert.Equal(t, tt.epoch, hls.epoch, tt.name)
+		assert.Equal(t, tt.last, hls.lastSeqId, tt.name)
+
+		if tt.name == "lagging edge" {
+			// Segments already delivered are not downloaded again
+			assert.NotEmpty(t, hls.lastSegments[SourceRendition], tt.name)
+		}
+	}
+
+	assert.Empty(t, hls.lastSegments)
+	assert.False(t, hls.advanceSequence(nil))
+}
+
+func TestAlignSegments(t *testing.T) {
+	seqIds := func(segments []*m3u8.MediaSegment) []uint64 {
+		ids := make([]uint64, 0)
+		for _, segment := range segments {
+			if segment != nil {
+				ids = append(ids, segment.SeqId)
+			}
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name   string
+		source []*m3u8.MediaSegment
+		want   []uint64
+	}{
+		{name: "source behind", source: playlistSegments(10, 12), want: []uint64{10, 11, 12}},
+		{name: "source ahead", source: playlistSegments(12, 16), want: []uint64{10, 11, 12, 13, 14}},
+		{name: "source empty", source: []*m3u8.MediaSegment{nil, nil}, want: []uint64{10, 11, 12, 13, 14}},
+		{name: "source missing", source: nil, want: []uint64{10, 11, 12, 13, 14}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, seqIds(alignSegments(playlistSegments(10, 14), tt.source)))
+		})
+	}
+}
+
+// staticSource serves the same playlists and segments on every request.
+type staticSource map[string]string
+
+func (s staticSource) open(_ context.Context, kind resourceKind, URI string) (io.ReadCloser, int64, error) {
+	body, ok := s[URI]
+	if !ok {
+		return nil, 0, fmt.Errorf("hls: fetching %s failed: 404 Not Found", kind)
+	}
+
+	return io.NopCloser(strings.NewReader(body)), int64(len(body)), nil
+}
+
+// fakeClock only moves when the client waits on it.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.now = c.now.Add(d)
+
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+// edgeSource is an edge serving a media playlist of the segments from to to.
+func edgeSource(from, to uint64) staticSource {
+	source := staticSource{
+		"master.m3u8": "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=6000000,RESOLUTION=1920x1080,VIDEO=\"chunked\"\nmedia.m3u8\n",
+	}
+
+	var media strings.Builder
+	fmt.Fprintf(&media, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:2\n#EXT-X-MEDIA-SEQUENCE:%d\n", from)
+	for seqId := from; seqId <= to; seqId++ {
+		fmt.Fprintf(&media, "#EXTINF:2.000,live\n%d.ts\n", seqId)
+		source[fmt.Sprintf("%d.ts", seqId)] = fmt.Sprintf("segment %d", seqId)
+	}
+	source["media.m3u8"] = media.String()
+
+	return source
+}
+
+func TestRunStalls(t *testing.T) {
+	client := newHlsClient()
+	client.MasterPlaylistURI = "master.m3u8"
+	client.source = edgeSource(10, 15)
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	client.clock = clock
+	delivered := collectSegments(client)
+
+	start := clock.now
+	err := client.Run(context.Background())
+	assert.ErrorIs(t, err, ErrStalled)
+	// Polled every target duration until 3 of them went by without progress
+	assert.Equal(t, 8*time.Second, clock.now.Sub(start))
+
+	// Reconnected to an edge lagging a segment behind, which stalls too
+	client.source = edgeSource(9, 14)
+	err = client.Run(context.Background())
+	assert.ErrorIs(t, err, ErrStalled)
+
+	// Segment 9 is older than what was delivered, and nothing is repeated
+	assert.ElementsMatch(t, []string{"segment 10", "segment 11", "segment 12", "segment 13", "segment 14", "segment 15"}, delivered())
+}
+
+func TestRunStallsUnanswered(t *testing.T) {
+	var serverURL string
+	var polls atomic.Int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/master.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=6000000,RESOLUTION=1920x1080,VIDEO=\"chunked\"\n%s/media.m3u8\n", serverURL)
+	})
+	mux.HandleFunc("/media.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		// The edge answers once and then gets wedged
+		if polls.Add(1) > 1 {
+			<-r.Context().Done()
+			return
+		}
+
+		fmt.Fprintf(w, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:1\n#EXT-X-MEDIA-SEQUENCE:10\n#EXTINF:1.000,live\n%s/10.ts\n", serverURL)
+	})
+	mux.HandleFunc("/10.ts", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("segment 10"))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	serverURL = server.URL
+
+	client := newHlsClient()
+	client.MasterPlaylistURI = server.URL + "/master.m3u8"
+	client.stallTargetDurations = 1
+
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Run(context.Background())
+	}()
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, ErrStalled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run kept waiting for the wedged media playlist")
+	}
+}
+
+func TestRunCancelledWhileWaiting(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/master.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := newHlsClient()
+	client.MasterPlaylistURI = server.URL + "/master.m3u8"
+
+	// The stream going offline interrupts the request
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	assert.NoError(t, client.Run(ctx))
+}
@@ -0,0 +1,112 @@
+package hls
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/grafov/m3u8"
+)
+
+// latencySamples is how many media playlist fetches the average latency is
+// computed over.
+const latencySamples = 30
+
+// latencyTracker measures how far behind the broadcast the capture is, from
+// the EXT-X-PROGRAM-DATE-TIME of the newest segment versus local time.
+type latencyTracker struct {
+	mu sync.Mutex
+
+	// clockOffset is how far the local clock is behind Twitch's, taken from
+	// the SERVER-TIME of the master playlist
+	clockOffset time.Duration
+
+	samples []time.Duration
+	next    int
+	current time.Duration
+}
+
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{
+		samples: make([]time.Duration, 0, latencySamples),
+	}
+}
+
+// midpoint is when a playlist requested at sentAt and received at receivedAt
+// was most likely generated, so the round trip does not count as latency.
+func midpoint(sentAt, receivedAt time.Time) time.Time {
+	return sentAt.Add(receivedAt.Sub(sentAt) / 2)
+}
+
+// syncClock uses the SERVER-TIME attribute of EXT-X-TWITCH-INFO, if present,
+// to correct the local clock.
+func (lt *latencyTracker) syncClock(info map[string]string, fetchedAt time.Time) {
+	serverTime, err := strconv.ParseFloat(info["SERVER-TIME"], 64)
+	if err != nil {
+		return
+	}
+
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	lt.clockOffset = time.Unix(0, int64(serverTime*float64(time.Second))).Sub(fetchedAt)
+}
+
+// observe records the latency of a media playlist fetched at fetchedAt.
+func (lt *latencyTracker) observe(playlistSegments []*m3u8.MediaSegment, fetchedAt time.Time) {
+	var live time.Time
+	for _, segment := range playlistSegments {
+		if segment == nil {
+			break
+		}
+
+		duration := time.Duration(segment.Duration * float64(time.Second))
+
+		switch {
+		case !segment.ProgramDateTime.IsZero():
+			live = segment.ProgramDateTime.Add(duration)
+		case !live.IsZero():
+			live = live.Add(duration)
+		}
+	}
+
+	if live.IsZero() {
+		return
+	}
+
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	latency := fetchedAt.Add(lt.clockOffset).Sub(live)
+	lt.current = latency
+
+	if len(lt.samples) < latencySamples {
+		lt.samples = append(lt.samples, latency)
+	} else {
+		lt.samples[lt.next] = latency
+		lt.next = (lt.next + 1) % latencySamples
+	}
+}
+
+func (lt *latencyTracker) latency() time.Duration {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	return lt.current
+}
+
+func (lt *latencyTracker) average() time.Duration {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	if len(lt.samples) == 0 {
+		return 0
+	}
+
+	var sum time.Duration
+	for _, sample := range lt.samples {
+		sum += sample
+	}
+
+	return sum / time.Duration(len(lt.samples))
+}
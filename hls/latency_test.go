@@ -0,0 +1,121 @@
+package hls
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafov/m3u8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyObserve(t *testing.T) {
+	live := time.Date(2025, 5, 11, 13, 40, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		segments    []*m3u8.MediaSegment
+		clockOffset time.Duration
+		latency     time.Duration
+		observed    bool
+	}{
+		{
+			name: "last segment dated",
+			segments: []*m3u8.MediaSegment{
+				{Duration: 2, ProgramDateTime: live.Add(-4 * time.Second)},
+				{Duration: 2, ProgramDateTime: live.Add(-2 * time.Second)},
+				nil,
+			},
+			latency:  5 * time.Second,
+			observed: true,
+		},
+		{
+			name: "only first segment dated",
+			segments: []*m3u8.MediaSegment{
+				{Duration: 2, ProgramDateTime: live.Add(-4 * time.Second)},
+				{Duration: 2},
+				nil,
+			},
+			latency:  5 * time.Second,
+			observed: true,
+		},
+		{
+			name: "local clock behind",
+			segments: []*m3u8.MediaSegment{
+				{Duration: 2, ProgramDateTime: live.Add(-2 * time.Second)},
+			},
+			clockOffset: 3 * time.Second,
+			latency:     8 * time.Second,
+			observed:    true,
+		},
+		{
+			name:     "no dates",
+			segments: []*m3u8.MediaSegment{{Duration: 2}, nil},
+		},
+		{
+			name: "empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lt := newLatencyTracker()
+			lt.clockOffset = tt.clockOffset
+
+			lt.observe(tt.segments, live.Add(5*time.Second))
+			assert.Equal(t, tt.latency, lt.latency())
+			assert.Equal(t, tt.observed, len(lt.samples) == 1)
+		})
+	}
+}
+
+func TestLatencySyncClock(t *testing.T) {
+	fetchedAt := time.Date(2025, 5, 11, 13, 40, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		serverTime string
+		offset     time.Duration
+	}{
+		{name: "server ahead", serverTime: "1746970802.50", offset: 2500 * time.Millisecond},
+		{name: "server behind", serverTime: "1746970799.00", offset: -time.Second},
+		{name: "missing", serverTime: "", offset: 0},
+		{name: "invalid", serverTime: "soon", offset: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lt := newLatencyTracker()
+			info := map[string]string{}
+			if tt.serverTime != "" {
+				info["SERVER-TIME"] = tt.serverTime
+			}
+
+			lt.syncClock(info, fetchedAt)
+			assert.InDelta(t, tt.offset, lt.clockOffset, float64(time.Millisecond))
+		})
+	}
+}
+
+func TestLatencyAverage(t *testing.T) {
+	live := time.Date(2025, 5, 11, 13, 40, 0, 0, time.UTC)
+	segments := []*m3u8.MediaSegment{{Duration: 2, ProgramDateTime: live.Add(-2 * time.Second)}}
+
+	lt := newLatencyTracker()
+	assert.Zero(t, lt.average())
+
+	// The oldest samples are replaced once there are latencySamples of them
+	for i := 0; i < latencySamples; i++ {
+		lt.observe(segments, live.Add(10*time.Second))
+	}
+	for i := 0; i < latencySamples/2; i++ {
+		lt.observe(segments, live.Add(4*time.Second))
+	}
+
+	assert.Equal(t, 7*time.Second, lt.average())
+	assert.Equal(t, 4*time.Second, lt.latency())
+}
+
+func TestMidpoint(t *testing.T) {
+	sentAt := time.Date(2025, 5, 11, 13, 40, 0, 0, time.UTC)
+	assert.Equal(t, sentAt.Add(300*time.Millisecond), midpoint(sentAt, sentAt.Add(600*time.Millisecond)))
+}
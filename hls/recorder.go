@@ -0,0 +1,189 @@
+package hls
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const recordingIndex = "index.ndjson"
+
+// errRecordingFull is returned by Recorder.create once the recording reached
+// its size limit.
+var errRecordingFull = errors.New("hls: recording is full")
+
+// recordEntry is a single line of the recording index.
+type recordEntry struct {
+	Time time.Time    `json:"time"`
+	Kind resourceKind `json:"kind"`
+	URI  string       `json:"uri"`
+	File string       `json:"file"`
+}
+
+// Recorder writes every playlist and segment fetched by the client to a
+// directory, so a misbehaving capture can be replayed offline with Replay.
+// Recording into a directory again goes on after what is already there.
+type Recorder struct {
+	dir string
+
+	mu    sync.Mutex
+	index *os.File
+	count int
+	// bytes is the size of the recorded files, recording stops once it
+	// reaches maxBytes
+	bytes    int64
+	maxBytes int64
+}
+
+func NewRecorder(dir string) (*Recorder, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{dir: dir}
+	err = r.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	r.index, err = os.OpenFile(filepath.Join(dir, recordingIndex), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// scan picks up the count and size of the files recorded by earlier runs, so
+// they are neither overwritten nor left out of the size limit.
+func (r *Recorder) scan() error {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		var count int
+		if _, err := fmt.Sscanf(entry.Name(), "%06d-", &count); err != nil {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		r.count = max(r.count, count)
+		r.bytes += info.Size()
+	}
+
+	return nil
+}
+
+// SetMaxBytes stops recording once the recorded files take up maxBytes. 0
+// means no limit.
+func (r *Recorder) SetMaxBytes(maxBytes int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.maxBytes = maxBytes
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.index.Close()
+}
+
+func (r *Recorder) create(kind resourceKind) (*os.File, string, error) {
+	r.mu.Lock()
+	if r.maxBytes > 0 && r.bytes >= r.maxBytes {
+		r.mu.Unlock()
+		return nil, "", errRecordingFull
+	}
+
+	r.count++
+	count := r.count
+	r.mu.Unlock()
+
+	ext := ".m3u8"
+	if kind == segmentKind {
+		ext = ".ts"
+	}
+
+	name := fmt.Sprintf("%06d-%s%s", count, kind, ext)
+	f, err := os.Create(filepath.Join(r.dir, name))
+	return f, name, err
+}
+
+func (r *Recorder) write(entry recordEntry, size int64) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.bytes += size
+
+	_, err = r.index.Write(append(line, '\n'))
+	return err
+}
+
+// recordingSource tees everything read from source into the recorder.
+type recordingSource struct {
+	source   source
+	clock    clock
+	recorder *Recorder
+}
+
+func (s *recordingSource) open(ctx context.Context, kind resourceKind, URI string) (io.ReadCloser, int64, error) {
+	fetchedAt := s.clock.Now()
+
+	body, size, err := s.source.open(ctx, kind, URI)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	f, name, err := s.recorder.create(kind)
+	if err != nil {
+		// A broken or full recording should not break the capture
+		return body, size, nil
+	}
+
+	return &recordingBody{
+		Reader: io.TeeReader(body, f),
+		body:   body,
+		file:   f,
+		onClose: func(written int64) {
+			s.recorder.write(recordEntry{Time: fetchedAt, Kind: kind, URI: URI, File: name}, written)
+		},
+	}, size, nil
+}
+
+type recordingBody struct {
+	io.Reader
+	body    io.Closer
+	file    *os.File
+	onClose func(written int64)
+}
+
+func (b *recordingBody) Close() error {
+	var written int64
+	if info, err := b.file.Stat(); err == nil {
+		written = info.Size()
+	}
+
+	b.file.Close()
+	b.onClose(written)
+	return b.body.Close()
+}
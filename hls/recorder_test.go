@@ -0,0 +1,46 @@
+package hls
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorderGoesOnAfterEarlierRuns(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "000041-segment.ts"), []byte("segment"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "000042-media.m3u8"), []byte("#EXTM3U"), 0644))
+
+	recorder, err := NewRecorder(dir)
+	assert.NoError(t, err)
+	defer recorder.Close()
+
+	f, name, err := recorder.create(segmentKind)
+	assert.NoError(t, err)
+	f.Close()
+	assert.Equal(t, "000043-segment.ts", name)
+
+	body, err := os.ReadFile(filepath.Join(dir, "000042-media.m3u8"))
+	assert.NoError(t, err)
+	assert.Equal(t, "#EXTM3U", string(body))
+}
+
+func TestRecorderMaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "000001-segment.ts"), []byte("segment"), 0644))
+
+	recorder, err := NewRecorder(dir)
+	assert.NoError(t, err)
+	defer recorder.Close()
+
+	recorder.SetMaxBytes(10)
+	f, _, err := recorder.create(segmentKind)
+	assert.NoError(t, err)
+	f.Close()
+	assert.NoError(t, recorder.write(recordEntry{Kind: segmentKind, File: "000002-segment.ts"}, 7))
+
+	_, _, err = recorder.create(segmentKind)
+	assert.ErrorIs(t, err, errRecordingFull)
+}
@@ -0,0 +1,147 @@
+package hls
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/grafov/m3u8"
+)
+
+const (
+	// A rendition is stepped down when downloading its segments takes longer
+	// than downgradeLoad of their duration for downgradePolls polls in a row.
+	downgradeLoad  = 0.8
+	downgradePolls = 2
+
+	// A rendition is stepped back up when the better variant is expected to
+	// download in less than upgradeLoad of its duration for upgradePolls polls
+	// in a row.
+	upgradeLoad  = 0.5
+	upgradePolls = 5
+)
+
+// SourceRendition is the key of segments of the main rendition, the best
+// variant the bandwidth allows.
+const SourceRendition = "source"
+
+// Rendition describes a single variant of the master playlist.
+type Rendition struct {
+	Name       string
+	Bandwidth  uint32
+	Resolution string
+}
+
+type RenditionChange struct {
+	From Rendition
+	To   Rendition
+}
+
+func newRendition(variant *m3u8.Variant) Rendition {
+	name := variant.Name
+	for _, alternative := range variant.Alternatives {
+		if alternative != nil && alternative.Type == "VIDEO" && alternative.Name != "" {
+			name = alternative.Name
+			break
+		}
+	}
+
+	if name == "" {
+		name = variant.Video
+	}
+
+	return Rendition{
+		Name:       name,
+		Bandwidth:  variant.Bandwidth,
+		Resolution: variant.Resolution,
+	}
+}
+
+// adaptiveRendition picks the variant to capture based on how fast its
+// segments download compared to how much media they hold.
+type adaptiveRendition struct {
+	// variants are sorted from the best to the worst
+	variants []*m3u8.Variant
+	current  int
+
+	pressure int
+	headroom int
+}
+
+func newAdaptiveRendition(variants []*m3u8.Variant) *adaptiveRendition {
+	ar := &adaptiveRendition{
+		variants: make([]*m3u8.Variant, 0, len(variants)),
+	}
+
+	for _, variant := range variants {
+		if variant == nil || variant.Iframe || variant.Video == "audio_only" {
+			continue
+		}
+
+		ar.variants = append(ar.variants, variant)
+	}
+
+	sort.SliceStable(ar.variants, func(i, j int) bool {
+		return ar.variants[i].Bandwidth > ar.variants[j].Bandwidth
+	})
+
+	return ar
+}
+
+func (ar *adaptiveRendition) variant() *m3u8.Variant {
+	return ar.variants[ar.current]
+}
+
+// find returns the variant whose name starts with name, e.g. "160p" matches
+// "160p30", or the worst variant when the stream has no such variant.
+func (ar *adaptiveRendition) find(name string) *m3u8.Variant {
+	for _, variant := range ar.variants {
+		if strings.HasPrefix(strings.ToLower(newRendition(variant).Name), strings.ToLower(name)) {
+			return variant
+		}
+	}
+
+	return ar.variants[len(ar.variants)-1]
+}
+
+// update takes the load of the last poll, i.e. the time it took to download
+// its segments divided by their duration, and reports whether the rendition
+// has changed.
+func (ar *adaptiveRendition) update(load float64) bool {
+	switch {
+	case load > downgradeLoad:
+		ar.headroom = 0
+		ar.pressure++
+
+		if ar.pressure >= downgradePolls && ar.current < len(ar.variants)-1 {
+			ar.current++
+			ar.pressure = 0
+			return true
+		}
+
+	case ar.current > 0 && load*ar.upgradeCost() < upgradeLoad:
+		ar.pressure = 0
+		ar.headroom++
+
+		if ar.headroom >= upgradePolls {
+			ar.current--
+			ar.headroom = 0
+			return true
+		}
+
+	default:
+		ar.pressure = 0
+		ar.headroom = 0
+	}
+
+	return false
+}
+
+// upgradeCost is how many times more data the next better variant needs.
+func (ar *adaptiveRendition) upgradeCost() float64 {
+	current := ar.variants[ar.current].Bandwidth
+	if current == 0 {
+		return 1
+	}
+
+	return float64(ar.variants[ar.current-1].Bandwidth) / float64(current)
+}
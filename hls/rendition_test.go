@@ -0,0 +1,46 @@
+package hls
+
+import (
+	"testing"
+
+	"github.com/grafov/m3u8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptiveRendition(t *testing.T) {
+	variants := []*m3u8.Variant{
+		{URI: "480p", VariantParams: m3u8.VariantParams{Bandwidth: 1_500_000, Video: "480p30"}},
+		{URI: "source", VariantParams: m3u8.VariantParams{Bandwidth: 6_000_000, Video: "chunked"}},
+		{URI: "audio", VariantParams: m3u8.VariantParams{Bandwidth: 160_000, Video: "audio_only"}},
+		{URI: "720p", VariantParams: m3u8.VariantParams{Bandwidth: 3_000_000, Video: "720p60"}},
+	}
+
+	ar := newAdaptiveRendition(variants)
+	assert.Len(t, ar.variants, 3)
+	assert.Equal(t, "source", ar.variant().URI)
+
+	tests := []struct {
+		load     float64
+		changed  bool
+		expected string
+	}{
+		{load: 0.9, changed: false, expected: "source"},
+		{load: 0.9, changed: true, expected: "720p"},
+		{load: 1.2, changed: false, expected: "720p"},
+		{load: 1.2, changed: true, expected: "480p"},
+		{load: 1.2, changed: false, expected: "480p"},
+		{load: 1.2, changed: false, expected: "480p"},
+		// 0.3 on 480p means 0.6 on 720p, not enough headroom
+		{load: 0.3, changed: false, expected: "480p"},
+		{load: 0.2, changed: false, expected: "480p"},
+		{load: 0.2, changed: false, expected: "480p"},
+		{load: 0.2, changed: false, expected: "480p"},
+		{load: 0.2, changed: false, expected: "480p"},
+		{load: 0.2, changed: true, expected: "720p"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.changed, ar.update(tt.load))
+		assert.Equal(t, tt.expected, ar.variant().URI)
+	}
+}
@@ -0,0 +1,182 @@
+package hls
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrEndOfRecording is returned once a replay has served the last recorded
+// media playlist.
+var ErrEndOfRecording = errors.New("hls: end of recording")
+
+// Replay serves a recording made by Recorder as if it was Twitch. Playlists
+// are served as they were at the same point of the recording, at original
+// timing or accelerated by speed.
+type Replay struct {
+	dir   string
+	speed float64
+
+	playlists map[resourceKind][]recordEntry
+	segments  map[string]string
+
+	mu     sync.Mutex
+	start  time.Time
+	began  time.Time
+	served map[string]int
+}
+
+func NewReplay(dir string, speed float64) (*Replay, error) {
+	if speed <= 0 {
+		return nil, fmt.Errorf("hls: invalid replay speed %v", speed)
+	}
+
+	f, err := os.Open(filepath.Join(dir, recordingIndex))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := &Replay{
+		dir:       dir,
+		speed:     speed,
+		playlists: make(map[resourceKind][]recordEntry),
+		segments:  make(map[string]string),
+		served:    make(map[string]int),
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry recordEntry
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return nil, err
+		}
+
+		if entry.Kind == segmentKind {
+			r.segments[entry.URI] = entry.File
+			continue
+		}
+
+		r.playlists[entry.Kind] = append(r.playlists[entry.Kind], entry)
+		if r.start.IsZero() || entry.Time.Before(r.start) {
+			r.start = entry.Time
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(r.playlists[masterPlaylistKind]) == 0 || len(r.playlists[mediaPlaylistKind]) == 0 {
+		return nil, errors.New("hls: recording has no playlists")
+	}
+
+	for _, entries := range r.playlists {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].Time.Before(entries[j].Time)
+		})
+	}
+
+	return r, nil
+}
+
+// rewind starts the replay over from the beginning of the recording.
+func (r *Replay) rewind() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.began = time.Now()
+	r.served = make(map[string]int)
+}
+
+// Now is the point of the recording the replay is at.
+func (r *Replay) Now() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.start.Add(time.Duration(float64(time.Since(r.began)) * r.speed))
+}
+
+func (r *Replay) After(d time.Duration) <-chan time.Time {
+	return time.After(time.Duration(float64(d) / r.speed))
+}
+
+// open serves the recorded file right away, so it does not need ctx.
+func (r *Replay) open(_ context.Context, kind resourceKind, URI string) (io.ReadCloser, int64, error) {
+	file, err := r.lookup(kind, URI)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	f, err := os.Open(filepath.Join(r.dir, file))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+
+	return f, info.Size(), nil
+}
+
+// lookup returns the file holding the resource. Segments are looked up by
+// URI, playlists as the latest one recorded before the current point of the
+// replay.
+func (r *Replay) lookup(kind resourceKind, URI string) (string, error) {
+	if kind == segmentKind {
+		file, ok := r.segments[URI]
+		if !ok {
+			return "", fmt.Errorf("hls: segment %s was not recorded", URI)
+		}
+
+		return file, nil
+	}
+
+	now := r.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// With several renditions captured, each media playlist is served from
+	// the fetches of its own URI
+	all := r.playlists[kind]
+	entries := make([]recordEntry, 0, len(all))
+	for _, entry := range all {
+		if entry.URI == URI {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		entries = all
+	}
+
+	i := sort.Search(len(entries), func(i int) bool {
+		return entries[i].Time.After(now)
+	})
+
+	// Nothing was fetched yet at this point, serve the first one
+	if i == 0 {
+		i = 1
+	}
+
+	key := string(kind) + " " + URI
+	ended := now.After(all[len(all)-1].Time)
+	if kind == mediaPlaylistKind && ended && r.served[key] == len(entries) && i == len(entries) {
+		return "", ErrEndOfRecording
+	}
+
+	r.served[key] = i
+	return entries[i-1].File, nil
+}
@@ -0,0 +1,84 @@
+package hls
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	var serverURL string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/master.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=6000000,RESOLUTION=1920x1080,VIDEO=\"chunked\"\n%s/media.m3u8\n", serverURL)
+	})
+	mux.HandleFunc("/media.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:1\n#EXT-X-MEDIA-SEQUENCE:10\n#EXTINF:1.000,live\n%[1]s/10.ts\n#EXTINF:1.000,live\n%[1]s/11.ts\n", serverURL)
+	})
+	mux.HandleFunc("/10.ts", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("segment 10"))
+	})
+	mux.HandleFunc("/11.ts", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("segment 11"))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	serverURL = server.URL
+
+	dir := t.TempDir()
+	recorder, err := NewRecorder(dir)
+	assert.NoError(t, err)
+
+	live := newHlsClient()
+	live.MasterPlaylistURI = server.URL + "/master.m3u8"
+	live.source = &recordingSource{source: live.source, clock: live.clock, recorder: recorder}
+
+	// Long enough for a single poll of the media playlist
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	recorded := collectSegments(live)
+	err = live.Run(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, recorder.Close())
+	assert.ElementsMatch(t, []string{"segment 10", "segment 11"}, recorded())
+
+	replay, err := NewReplay(dir, 100)
+	assert.NoError(t, err)
+
+	offline := newHlsClient()
+	offline.source = replay
+	offline.clock = replay
+	replay.rewind()
+
+	replayed := collectSegments(offline)
+	err = offline.Run(context.Background())
+	assert.ErrorIs(t, err, ErrEndOfRecording)
+	assert.ElementsMatch(t, []string{"segment 10", "segment 11"}, replayed())
+}
+
+// collectSegments stores the bodies of all segments delivered by client.
+func collectSegments(client *hlsClient) func() []string {
+	var mu sync.Mutex
+	segments := make([]string, 0)
+
+	client.onMediaSegmentWithBytes = func(media MediaSegmentWithBytes) {
+		mu.Lock()
+		defer mu.Unlock()
+		segments = append(segments, string(media.Bytes.Bytes()))
+	}
+
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return segments
+	}
+}
@@ -0,0 +1,62 @@
+package hls
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+type resourceKind string
+
+const (
+	masterPlaylistKind resourceKind = "master"
+	mediaPlaylistKind  resourceKind = "media"
+	segmentKind        resourceKind = "segment"
+)
+
+// source fetches playlists and segments. It is either Twitch itself, or a
+// recording replayed from disk.
+type source interface {
+	// open returns the body of the resource and its size, or -1 when the size
+	// is unknown. Fetching and reading the body give up once ctx is done.
+	open(ctx context.Context, kind resourceKind, URI string) (io.ReadCloser, int64, error)
+}
+
+// clock is the time base of the capture loop, a replay runs on its own.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type httpSource struct {
+	restyClient *resty.Client
+}
+
+func (s *httpSource) open(ctx context.Context, kind resourceKind, URI string) (io.ReadCloser, int64, error) {
+	resp, err := s.restyClient.R().SetContext(ctx).SetDoNotParseResponse(true).Get(URI)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rawBody := resp.RawBody()
+
+	if resp.IsError() {
+		rawBody.Close()
+		return nil, 0, fmt.Errorf("hls: fetching %s failed: %s", kind, resp.Status())
+	}
+
+	return rawBody, resp.RawResponse.ContentLength, nil
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
@@ -0,0 +1,115 @@
+package hls
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafov/m3u8"
+)
+
+const (
+	twitchInfoTag = "#EXT-X-TWITCH-INFO:"
+	dateRangeTag  = "#EXT-X-DATERANGE:"
+)
+
+// DateRange is an EXT-X-DATERANGE of the media playlist, e.g. an ad break
+// ("twitch-stitched-ad") or a stream source marker ("twitch-stream-source").
+type DateRange struct {
+	ID        string
+	Class     string
+	StartDate time.Time
+	// Duration is 0 when the date range has neither DURATION nor END-DATE
+	Duration time.Duration
+	// Attributes hold all attributes of the tag, including the ones above
+	// and the client defined X- ones
+	Attributes map[string]string
+}
+
+// attributeListTag is a playlist tag whose value is an attribute list, like
+// Twitch's EXT-X-TWITCH-INFO.
+type attributeListTag struct {
+	name       string
+	line       string
+	Attributes map[string]string
+}
+
+func (t *attributeListTag) TagName() string {
+	return t.name
+}
+
+func (t *attributeListTag) Encode() *bytes.Buffer {
+	return bytes.NewBufferString(t.line)
+}
+
+func (t *attributeListTag) String() string {
+	return t.line
+}
+
+type attributeListDecoder struct {
+	name string
+	// decoded collects every tag decoded, as playlists keep only the last tag
+	// of each name
+	decoded []*attributeListTag
+	last    string
+}
+
+func (d *attributeListDecoder) TagName() string {
+	return d.name
+}
+
+func (d *attributeListDecoder) Decode(line string) (m3u8.CustomTag, error) {
+	tag := &attributeListTag{
+		name:       d.name,
+		line:       line,
+		Attributes: m3u8.DecodeAttributeList(strings.TrimPrefix(line, d.name)),
+	}
+
+	// m3u8 feeds every line to both the master and the media playlist
+	// decoder, so each tag is decoded twice in a row
+	if line == d.last {
+		d.last = ""
+		return tag, nil
+	}
+
+	d.last = line
+	d.decoded = append(d.decoded, tag)
+	return tag, nil
+}
+
+func (d *attributeListDecoder) SegmentTag() bool {
+	return false
+}
+
+// twitchInfo returns the attributes of the EXT-X-TWITCH-INFO tag of a master
+// playlist, or nil when the playlist has none.
+func twitchInfo(masterPlaylist *m3u8.MasterPlaylist) map[string]string {
+	tag, ok := masterPlaylist.Custom[twitchInfoTag].(*attributeListTag)
+	if !ok {
+		return nil
+	}
+
+	return tag.Attributes
+}
+
+func newDateRange(tag *attributeListTag) DateRange {
+	attributes := tag.Attributes
+
+	dateRange := DateRange{
+		ID:         attributes["ID"],
+		Class:      attributes["CLASS"],
+		Attributes: attributes,
+	}
+
+	// Malformed dates are left zero rather than failing the whole playlist
+	dateRange.StartDate, _ = m3u8.TimeParse(attributes["START-DATE"])
+
+	if duration, err := strconv.ParseFloat(attributes["DURATION"], 64); err == nil {
+		dateRange.Duration = time.Duration(duration * float64(time.Second))
+	} else if endDate, err := m3u8.TimeParse(attributes["END-DATE"]); err == nil && !dateRange.StartDate.IsZero() {
+		dateRange.Duration = endDate.Sub(dateRange.StartDate)
+	}
+
+	return dateRange
+}
@@ -0,0 +1,42 @@
+package hls
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafov/m3u8"
+	"github.com/stretchr/testify/assert"
+)
+
+const twitchMediaPlaylist = `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:6
+#EXT-X-MEDIA-SEQUENCE:4107
+#EXT-X-TWITCH-ELAPSED-SECS:8213.000
+#EXT-X-DATERANGE:ID="source-1700000000",CLASS="twitch-stream-source",START-DATE="2025-05-11T13:40:02.289Z",END-ON-NEXT=YES,X-TV-TWITCH-STREAM-SOURCE="live"
+#EXT-X-DATERANGE:ID="stitched-ad-1700000010-30",CLASS="twitch-stitched-ad",START-DATE="2025-05-11T13:40:12.289Z",DURATION=30.000,X-TV-TWITCH-AD-ROLL-TYPE="MIDROLL"
+#EXT-X-PROGRAM-DATE-TIME:2025-05-11T13:40:02.289Z
+#EXTINF:2.000,live
+https://video-edge.example/v1/segment/4107.ts
+`
+
+func TestDateRanges(t *testing.T) {
+	decoder := &attributeListDecoder{name: dateRangeTag}
+
+	_, _, err := m3u8.DecodeWith(strings.NewReader(twitchMediaPlaylist), true, []m3u8.CustomDecoder{decoder})
+	assert.NoError(t, err)
+	assert.Len(t, decoder.decoded, 2)
+
+	source := newDateRange(decoder.decoded[0])
+	assert.Equal(t, "source-1700000000", source.ID)
+	assert.Equal(t, "twitch-stream-source", source.Class)
+	assert.Equal(t, time.Date(2025, 5, 11, 13, 40, 2, 289000000, time.UTC), source.StartDate.UTC())
+	assert.Equal(t, time.Duration(0), source.Duration)
+	assert.Equal(t, "live", source.Attributes["X-TV-TWITCH-STREAM-SOURCE"])
+
+	ad := newDateRange(decoder.decoded[1])
+	assert.Equal(t, "twitch-stitched-ad", ad.Class)
+	assert.Equal(t, 30*time.Second, ad.Duration)
+	assert.Equal(t, "MIDROLL", ad.Attributes["X-TV-TWITCH-AD-ROLL-TYPE"])
+}
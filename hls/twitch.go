@@ -2,20 +2,29 @@ package hls
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 )
 
+// gqlURL is the Twitch GraphQL endpoint playback access tokens come from.
+const gqlURL = "https://gql.twitch.tv/gql"
+
 type Client struct {
 	restyClient *resty.Client
 	hlsClient   *hlsClient
+	gqlURL      string
 
 	channel     string
 	accessToken *streamPlaybackAccessToken
+	oauthToken  string
+
+	onStall func()
 }
 
 func NewTwitchHLSClient() *Client {
@@ -25,6 +34,7 @@ func NewTwitchHLSClient() *Client {
 	return &Client{
 		restyClient: restyClient,
 		hlsClient:   hlsClient,
+		gqlURL:      gqlURL,
 	}
 }
 
@@ -40,13 +50,123 @@ func (c *Client) Join(channel string) error {
 	return nil
 }
 
+// SetOAuthToken makes the client request playback access as the user owning
+// the token instead of anonymously. A subscribed or Turbo account gets
+// sub-only streams and ad-free playback.
+func (c *Client) SetOAuthToken(token string) {
+	c.oauthToken = token
+}
+
+// SetEpoch makes the epochs of the segments start at epoch instead of 0, e.g.
+// to go on after the ones restored from a previous run.
+func (c *Client) SetEpoch(epoch uint64) {
+	c.hlsClient.epoch = epoch
+}
+
 func (c *Client) OnMediaSegmentWithBytes(callback func(mediaSegmentWithBytes MediaSegmentWithBytes)) {
 	c.hlsClient.onMediaSegmentWithBytes = callback
 }
 
+// AddRendition captures the variant named name, e.g. "160p", alongside the
+// source rendition. Its segments are delivered with Rendition set to key and
+// cover the same SeqIds as the source ones. The worst variant is captured
+// when the stream has no such variant.
+func (c *Client) AddRendition(key, name string) {
+	if c.hlsClient.extraRenditions == nil {
+		c.hlsClient.extraRenditions = make(map[string]string)
+	}
+
+	c.hlsClient.extraRenditions[key] = name
+}
+
+// OnRenditionChange is called whenever the captured variant is stepped down
+// because segments download slower than real time, or back up once the
+// bandwidth recovers.
+func (c *Client) OnRenditionChange(callback func(renditionChange RenditionChange)) {
+	c.hlsClient.onRenditionChange = callback
+}
+
+// OnDateRange is called for every EXT-X-DATERANGE of the media playlist the
+// first time it shows up, and again whenever its attributes change.
+func (c *Client) OnDateRange(callback func(dateRange DateRange)) {
+	c.hlsClient.onDateRange = callback
+}
+
+// OnStall is called whenever the media playlist stalled or stopped answering,
+// right before the capture is restarted.
+func (c *Client) OnStall(callback func()) {
+	c.onStall = callback
+}
+
+// SetStallTargetDurations sets how many target durations the media playlist
+// may go without a new segment before the capture is restarted.
+func (c *Client) SetStallTargetDurations(targetDurations int) {
+	c.hlsClient.stallTargetDurations = targetDurations
+}
+
+// Latency is how far the last fetched media playlist was behind the
+// broadcast, or 0 when the playlist has no EXT-X-PROGRAM-DATE-TIME.
+func (c *Client) Latency() time.Duration {
+	return c.hlsClient.latency.latency()
+}
+
+// AverageLatency is the rolling average of Latency over the last media
+// playlist fetches.
+func (c *Client) AverageLatency() time.Duration {
+	return c.hlsClient.latency.average()
+}
+
+// SetRecorder records every playlist and segment fetched from Twitch from now
+// on, see Replay.
+func (c *Client) SetRecorder(recorder *Recorder) {
+	c.hlsClient.source = &recordingSource{
+		source:   c.hlsClient.source,
+		clock:    c.hlsClient.clock,
+		recorder: recorder,
+	}
+}
+
+// Replay feeds a recording through the same capture path as Connect, calling
+// the same callbacks, until the recording ends or ctx is cancelled.
+func (c *Client) Replay(ctx context.Context, replay *Replay) error {
+	c.hlsClient.source = replay
+	c.hlsClient.clock = replay
+	replay.rewind()
+
+	for {
+		err := c.hlsClient.Run(ctx)
+		if !errors.Is(err, ErrStalled) {
+			return err
+		}
+
+		if c.onStall != nil {
+			c.onStall()
+		}
+	}
+}
+
+// Connect captures the stream until ctx is cancelled or the playlist is
+// closed. When the media playlist stalls, a fresh access token and master
+// playlist are requested, which may land on a different edge, and the capture
+// resumes right away. Segments that were already delivered are not repeated.
 func (c *Client) Connect(ctx context.Context) error {
-	c.hlsClient.MasterPlaylistURI = c.fmtMasterPlaylistURI()
-	return c.hlsClient.Run(ctx)
+	for {
+		c.hlsClient.MasterPlaylistURI = c.fmtMasterPlaylistURI()
+
+		err := c.hlsClient.Run(ctx)
+		if !errors.Is(err, ErrStalled) {
+			return err
+		}
+
+		if c.onStall != nil {
+			c.onStall()
+		}
+
+		err = c.Join(c.channel)
+		if err != nil {
+			return err
+		}
+	}
 }
 
 func (c *Client) fmtMasterPlaylistURI() string {
@@ -110,8 +230,6 @@ type streamPlaybackAccessToken struct {
 }
 
 func (c *Client) getAccessToken(channel string) (*streamPlaybackAccessToken, error) {
-	gqlURL := "https://gql.twitch.tv/gql"
-
 	query := graphQLQuery{
 		OperationName: "PlaybackAccessToken",
 		Extensions: graphQLExtensions{
@@ -131,17 +249,25 @@ func (c *Client) getAccessToken(channel string) (*streamPlaybackAccessToken, err
 
 	var result playbackAccessTokenGraphQLResponse
 
-	_, err := c.restyClient.
+	request := c.restyClient.
 		R().
 		SetHeader("Client-ID", "kimne78kx3ncx6brgo4mv6wki5h1ko").
 		SetHeader("Content-Type", "application/json").
 		SetBody(query).
-		SetResult(&result).
-		Post(gqlURL)
+		SetResult(&result)
 
+	if c.oauthToken != "" {
+		request.SetHeader("Authorization", "OAuth "+c.oauthToken)
+	}
+
+	resp, err := request.Post(c.gqlURL)
 	if err != nil {
 		return nil, err
 	}
 
+	if resp.IsError() {
+		return nil, fmt.Errorf("hls: playback access token request failed: %s", resp.Status())
+	}
+
 	return &result.Data.StreamPlaybackAccessToken, nil
 }
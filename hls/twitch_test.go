@@ -0,0 +1,63 @@
+package hls
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAccessToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		oauthToken    string
+		authorization string
+	}{
+		{name: "anonymous", oauthToken: "", authorization: ""},
+		{name: "oauth", oauthToken: "secret", authorization: "OAuth secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var authorization string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				authorization = r.Header.Get("Authorization")
+
+				var query struct {
+					Variables playbackAcessTokenVariables `json:"variables"`
+				}
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&query))
+				assert.Equal(t, "channel", query.Variables.Login)
+
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"data":{"streamPlaybackAccessToken":{"signature":"sig","value":"token"}}}`))
+			}))
+			defer server.Close()
+
+			client := NewTwitchHLSClient()
+			client.gqlURL = server.URL
+			client.SetOAuthToken(tt.oauthToken)
+
+			token, err := client.getAccessToken("channel")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.authorization, authorization)
+			assert.Equal(t, &streamPlaybackAccessToken{Signature: "sig", Value: "token"}, token)
+		})
+	}
+}
+
+func TestGetAccessTokenRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	client := NewTwitchHLSClient()
+	client.gqlURL = server.URL
+	client.SetOAuthToken("expired")
+
+	_, err := client.getAccessToken("channel")
+	assert.Error(t, err)
+}
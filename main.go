@@ -2,9 +2,17 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/gempir/go-twitch-irc/v4"
@@ -17,13 +25,61 @@ import (
 	"go-gryps/webhooks"
 )
 
+const (
+	// defaultCaptureDelay is used until the stream latency was measured
+	defaultCaptureDelay = 30 * time.Second
+	captureDelayMargin  = 5 * time.Second
+
+	// preRoll and postRoll are how much video before and after a moderation
+	// event is persisted, unless a retention view for its kind says otherwise
+	preRoll  = 60 * time.Second
+	postRoll = 20 * time.Second
+
+	defaultRetentionViews = "ban=2m:20s,timeout=1m:20s,delete=30s:10s"
+
+	// persistTimeout bounds uploading a clip
+	persistTimeout = 10 * time.Minute
+
+	previewRendition = "preview"
+
+	// chatActivityWindow is how much chat before a moderation event its
+	// activity is measured over, and a rate chatSpikeFactor times the baseline
+	// counts as a spike
+	chatActivityWindow = 30 * time.Second
+	chatSpikeFactor    = 3
+
+	// moderatorTTL is how long who banned or timed out a user is remembered
+	// for the clip of it
+	moderatorTTL = 10 * time.Minute
+)
+
 type config struct {
 	env    string
 	secret string
 	port   int
+	hls    struct {
+		recordDir        string
+		recordMB         int
+		previewRendition string
+	}
+	media struct {
+		bufferSeconds int
+		bufferMB      int
+		bufferDir     string
+		// retentionViews are the windows of video per moderation event
+		// kind, e.g. ban=2m:20s for 2 minutes before and 20 seconds after
+		retentionViews string
+	}
+	messages struct {
+		bufferSeconds int
+		bufferCount   int
+	}
 	twitch struct {
-		channel string
+		channel        string
+		oauthTokenFile string
 	}
+	snapshotDir string
+	dumpDir     string
 }
 
 type application struct {
@@ -36,10 +92,28 @@ type application struct {
 	hlsClient     *hls.Client
 	webhookClient *webhooks.Client
 
-	persister persisters.Persister
+	persister        persisters.Persister
+	previewPersister persisters.Persister
 
-	mediaBuffer    *buffers.MediaBuffer
+	mediaBuffer    buffers.MediaStore
+	retention      *buffers.Retention
+	previewBuffer  *buffers.MediaBuffer
 	messagesBuffer *buffers.MessagesBuffer
+	chatActivity   *buffers.ChatActivity
+
+	// streamed is set once the first stream of this run started, the buffers
+	// are only cleared for the streams after it so what was restored is kept
+	streamed atomic.Bool
+
+	// moderators are who banned or timed out the users recently, by user ID,
+	// as only EventSub tells and not the chat
+	moderatorsMu sync.Mutex
+	moderators   map[string]moderatorEntry
+}
+
+type moderatorEntry struct {
+	moderator string
+	time      time.Time
 }
 
 func main() {
@@ -47,8 +121,21 @@ func main() {
 
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
 	flag.StringVar(&cfg.twitch.channel, "twitch-channel", "xqc", "Twitch channel")
+	flag.StringVar(&cfg.twitch.oauthTokenFile, "twitch-oauth-file", "", "File with a Twitch user OAuth token used for playback (falls back to $TWITCH_OAUTH_TOKEN)")
+	flag.StringVar(&cfg.hls.recordDir, "hls-record-dir", "", "Directory to record fetched playlists and segments to (disabled when empty)")
+	flag.IntVar(&cfg.hls.recordMB, "hls-record-mb", 1024, "Megabytes recorded at most, recording stops once reached (0 for no limit)")
+	flag.StringVar(&cfg.hls.previewRendition, "hls-preview-rendition", "", "Rendition to capture alongside the source for local previews, e.g. 160p (disabled when empty)")
+	flag.IntVar(&cfg.media.bufferSeconds, "media-buffer-seconds", 90, "Seconds of video kept per channel, grown to fit the largest retention view")
+	flag.StringVar(&cfg.media.retentionViews, "media-retention-views", defaultRetentionViews, "Video kept before:after each kind of moderation event (ban, timeout, delete), comma separated")
+	flag.IntVar(&cfg.media.bufferMB, "media-buffer-mb", 0, "Megabytes of video kept per channel, on top of the seconds limit (0 for no limit)")
+	flag.StringVar(&cfg.media.bufferDir, "media-buffer-dir", "", "Directory to keep buffered video in instead of memory, for long windows")
+	flag.IntVar(&cfg.messages.bufferSeconds, "messages-buffer-seconds", 600, "Seconds of chat kept per channel")
+	flag.IntVar(&cfg.messages.bufferCount, "messages-buffer-count", 20000, "Chat messages kept per channel, on top of the seconds limit (0 for no limit)")
+	flag.StringVar(&cfg.dumpDir, "dump-dir", "dumps", "Directory to dump the buffers to on SIGUSR1")
+	flag.StringVar(&cfg.snapshotDir, "snapshot-dir", "", "Directory to save the buffers to on shutdown and restore them from on startup (disabled when empty)")
 	flag.IntVar(&cfg.port, "port", 8080, "Webhook client port")
 	flag.StringVar(&cfg.secret, "secret", "your secret goes here", "Webhook client secret")
+	flag.Parse()
 
 	lvl := new(slog.LevelVar)
 	lvl.Set(slog.LevelDebug)
@@ -60,6 +147,29 @@ func main() {
 	twitchClient := twitch.NewAnonymousClient()
 	persister := persisters.NewYoutubePersister()
 	hlsClient := hls.NewTwitchHLSClient()
+
+	oauthToken, err := loadOAuthToken(cfg.twitch.oauthTokenFile)
+	if err != nil {
+		logger.Error("Failed to load Twitch OAuth token", "err", err)
+		os.Exit(1)
+	}
+	hlsClient.SetOAuthToken(oauthToken)
+
+	if cfg.hls.recordDir != "" {
+		recorder, err := hls.NewRecorder(cfg.hls.recordDir)
+		if err != nil {
+			logger.Error("Failed to create HLS recorder", "err", err)
+			os.Exit(1)
+		}
+		defer recorder.Close()
+		recorder.SetMaxBytes(int64(cfg.hls.recordMB) << 20)
+
+		hlsClient.SetRecorder(recorder)
+	}
+
+	if cfg.hls.previewRendition != "" {
+		hlsClient.AddRendition(previewRendition, cfg.hls.previewRendition)
+	}
 	webhookClient := webhooks.New(cfg.port, cfg.secret)
 
 	app := &application{
@@ -70,15 +180,155 @@ func main() {
 		persister:     persister,
 		hlsClient:     hlsClient,
 		webhookClient: webhookClient,
+		moderators:    make(map[string]moderatorEntry),
+	}
+
+	app.mediaBuffer = buffers.NewMediaBuffer(cfg.media.bufferSeconds)
+	if cfg.media.bufferDir != "" {
+		app.mediaBuffer, err = buffers.NewDiskMediaBuffer(filepath.Join(cfg.media.bufferDir, cfg.twitch.channel), cfg.media.bufferSeconds)
+		if err != nil {
+			logger.Error("Failed to create media buffer", "err", err)
+			os.Exit(1)
+		}
 	}
+	app.mediaBuffer.SetMaxBytes(int64(cfg.media.bufferMB) << 20)
 
-	app.mediaBuffer = buffers.NewMediaBuffer(90)
-	app.messagesBuffer = buffers.NewMessagesBuffer(600)
+	app.retention, err = newRetention(app.mediaBuffer, cfg.media.retentionViews)
+	if err != nil {
+		logger.Error("Failed to parse retention views", "err", err)
+		os.Exit(1)
+	}
+
+	app.messagesBuffer = buffers.NewMessagesBuffer(cfg.messages.bufferSeconds)
+	app.messagesBuffer.SetMaxCount(cfg.messages.bufferCount)
+	app.chatActivity = buffers.NewChatActivity(time.Duration(cfg.messages.bufferSeconds) * time.Second)
+
+	if cfg.hls.previewRendition != "" {
+		app.previewPersister = persisters.NewLocalPersister()
+		app.previewBuffer = buffers.NewMediaBuffer(cfg.media.bufferSeconds)
+		app.retention.Follow(app.previewBuffer)
+	}
 
-	app.start()
+	if cfg.snapshotDir != "" {
+		app.restore()
+	}
+
+	go app.dumpOnSignal()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	err = app.start(ctx)
+	if err != nil {
+		logger.Error("Webhook server failed", "err", err)
+	}
+
+	if cfg.snapshotDir != "" {
+		app.snapshot()
+	}
 }
 
-func (app *application) start() {
+// newRetention creates the views over store described by views, a comma
+// separated list of kind=preRoll:postRoll.
+func newRetention(store buffers.MediaStore, views string) (*buffers.Retention, error) {
+	retention := buffers.NewRetention(store, preRoll, postRoll)
+
+	for _, view := range strings.Split(views, ",") {
+		if strings.TrimSpace(view) == "" {
+			continue
+		}
+
+		kind, window, ok := strings.Cut(strings.TrimSpace(view), "=")
+		pre, post, ok2 := strings.Cut(window, ":")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("invalid retention view %q", view)
+		}
+
+		preDuration, err := time.ParseDuration(pre)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retention view %q: %w", view, err)
+		}
+
+		postDuration, err := time.ParseDuration(post)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retention view %q: %w", view, err)
+		}
+
+		retention.AddView(kind, preDuration, postDuration)
+	}
+
+	return retention, nil
+}
+
+// restore fills the buffers with what the previous run saved on shutdown, so
+// moderation events right after a restart still have context.
+func (app *application) restore() {
+	dir := filepath.Join(app.config.snapshotDir, app.config.twitch.channel)
+
+	err := app.mediaBuffer.Restore(filepath.Join(dir, "media"))
+	if err != nil {
+		app.logger.Error("Failed to restore media buffer", "err", err)
+	}
+
+	err = app.messagesBuffer.Restore(filepath.Join(dir, "messages.ndjson"))
+	if err != nil {
+		app.logger.Error("Failed to restore messages buffer", "err", err)
+	}
+
+	// The restored epochs are renumbered from 0, the stream goes on after them
+	segments := app.mediaBuffer.Segments()
+	if len(segments) > 0 {
+		app.hlsClient.SetEpoch(segments[len(segments)-1].Epoch + 1)
+	}
+	buffers.ReleaseSegments(segments)
+
+	stats := app.mediaBuffer.Stats()
+	app.logger.Info("Restored buffers", "segments", stats.Segments, "duration", stats.Duration, "messages", len(app.messagesBuffer.Messages()))
+}
+
+// dump writes the buffers to a timestamped directory under the dump
+// directory, returning it.
+func (app *application) dump() (string, error) {
+	timestamp := time.Now().Format("2006-01-02_150405")
+	dir := filepath.Join(app.config.dumpDir, app.config.twitch.channel, timestamp)
+
+	return dir, buffers.Dump(dir, app.mediaBuffer, app.messagesBuffer)
+}
+
+// snapshot saves the buffers on shutdown, for restore to pick them up again.
+func (app *application) snapshot() {
+	app.logger.Info("Shutting down, saving buffers")
+	dir := filepath.Join(app.config.snapshotDir, app.config.twitch.channel)
+
+	err := app.mediaBuffer.Snapshot(filepath.Join(dir, "media"))
+	if err != nil {
+		app.logger.Error("Failed to save media buffer", "err", err)
+	}
+
+	err = app.messagesBuffer.Snapshot(filepath.Join(dir, "messages.ndjson"))
+	if err != nil {
+		app.logger.Error("Failed to save messages buffer", "err", err)
+	}
+}
+
+// loadOAuthToken reads the viewer OAuth token from path, or from the
+// TWITCH_OAUTH_TOKEN environment variable when no path is given. An empty
+// token means anonymous playback.
+func loadOAuthToken(path string) (string, error) {
+	if path == "" {
+		return strings.TrimSpace(os.Getenv("TWITCH_OAUTH_TOKEN")), nil
+	}
+
+	token, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(token)), nil
+}
+
+// start serves the webhooks and follows the stream until ctx is done.
+func (app *application) start(ctx context.Context) error {
 	var cancelFunc context.CancelFunc
 
 	go app.listenToMessages()
@@ -90,10 +340,14 @@ func (app *application) start() {
 			cancelFunc()
 		}
 
-		ctx, cancel := context.WithCancel(context.Background())
+		streamCtx, cancel := context.WithCancel(ctx)
 		cancelFunc = cancel
 
-		go app.listenToStream(ctx)
+		go app.listenToStream(streamCtx)
+	})
+
+	app.webhookClient.OnChannelBan(func(ban webhooks.ChannelBan) {
+		app.rememberModerator(ban.UserID, ban.ModeratorUserLogin, ban.BannedAt)
 	})
 
 	app.webhookClient.OnStreamOffline(func() {
@@ -105,11 +359,23 @@ func (app *application) start() {
 		}
 	})
 
-	app.webhookClient.ListenAndServe()
+	err := app.webhookClient.ListenAndServe(ctx)
+
+	if cancelFunc != nil {
+		cancelFunc()
+	}
+	app.twitchClient.Disconnect()
+
+	return err
 }
 
 func (app *application) listenToStream(ctx context.Context) error {
-	app.mediaBuffer = buffers.NewMediaBuffer(90)
+	if app.streamed.Swap(true) {
+		app.mediaBuffer.Clear()
+		if app.previewBuffer != nil {
+			app.previewBuffer.Clear()
+		}
+	}
 
 	err := app.hlsClient.Join(app.config.twitch.channel)
 	if err != nil {
@@ -118,15 +384,36 @@ func (app *application) listenToStream(ctx context.Context) error {
 	}
 
 	app.hlsClient.OnMediaSegmentWithBytes(func(media hls.MediaSegmentWithBytes) {
-		app.logger.Debug("New media segment fetched", "SeqId", media.MediaSegment.SeqId)
+		app.logger.Debug("New media segment fetched", "Rendition", media.Rendition, "Epoch", media.Epoch, "SeqId", media.MediaSegment.SeqId)
 		mediaData := &buffers.MediaData{
+			Epoch:    media.Epoch,
 			SeqId:    media.MediaSegment.SeqId,
-			Data:     media.Bytes,
+			Data:     media.Bytes.Retain(),
 			Duration: media.MediaSegment.Duration,
+
+			ProgramDateTime: media.MediaSegment.ProgramDateTime,
 		}
+
+		if media.Rendition == previewRendition {
+			app.previewBuffer.Insert(mediaData)
+			return
+		}
+
 		app.mediaBuffer.Insert(mediaData)
 	})
 
+	app.hlsClient.OnRenditionChange(func(change hls.RenditionChange) {
+		app.logger.Warn("Rendition changed", "from", change.From.Name, "to", change.To.Name)
+	})
+
+	app.hlsClient.OnDateRange(func(dateRange hls.DateRange) {
+		app.logger.Info("Date range", "id", dateRange.ID, "class", dateRange.Class, "start", dateRange.StartDate, "duration", dateRange.Duration)
+	})
+
+	app.hlsClient.OnStall(func() {
+		app.logger.Warn("Media playlist stalled, reconnecting")
+	})
+
 	// TODO: instead of passing a context I should probably add a Close method
 	err = app.hlsClient.Connect(ctx)
 	if err != nil {
@@ -137,23 +424,155 @@ func (app *application) listenToStream(ctx context.Context) error {
 	return nil
 }
 
-func (app *application) persistStream(userName string) error {
+// errNothingBuffered is returned by persistStream when there is no video to
+// persist, so the event does not use up the throttle interval.
+var errNothingBuffered = errors.New("no video buffered")
+
+// moderationEvent is a ban, timeout or deleted message worth a clip.
+type moderationEvent struct {
+	// kind picks the retention view, e.g. ban
+	kind     string
+	userID   string
+	userName string
+	time     time.Time
+}
+
+func (app *application) persistStream(event moderationEvent) error {
+	view := app.retention.View(event.kind)
+	capture := view.Capture(event.time)
+
+	// The post-roll shows up in the buffer only after the stream latency
+	ctx, cancel := context.WithTimeout(context.Background(), app.captureDelay()+view.PostRoll)
+	defer cancel()
+
+	clip, err := capture.Wait(ctx)
+	defer clip.Release()
+	if err != nil {
+		app.logger.Warn("Persisting incomplete clip", "err", err)
+	}
+
+	if len(clip.Segments) == 0 {
+		app.logger.Warn("Not persisting stream, no video was buffered", "kind", event.kind, "user", event.userName)
+		return errNothingBuffered
+	}
+
 	app.logger.Info("Persisting stream...")
+	userName := event.userName
 	messages := app.messagesBuffer.GetByUserName(userName, 3)
-	media := app.mediaBuffer.Segments()
+	if event.userID != "" {
+		messages = app.messagesBuffer.GetByUserID(event.userID, 3)
+	}
+
+	stats := app.mediaBuffer.Stats()
+	app.logger.Debug("Media buffer", "bytes", stats.Bytes, "duration", stats.Duration, "segments", stats.Segments, "missingSegments", stats.MissingSegments)
+	app.logger.Debug("Clip cut", "start", clip.Start, "duration", clip.Duration, "offset", clip.Offset)
+	activity := app.chatActivity.Stats(event.time, chatActivityWindow)
+	app.logger.Info("Chat activity", "rate", activity.Rate, "baseline", activity.Baseline, "chatters", activity.Chatters, "spike", activity.Spike(chatSpikeFactor))
+	if !clip.Complete() {
+		app.logger.Warn("Clip has gaps", "gaps", len(clip.Gaps), "missing", clip.MissingDuration())
+	}
+
+	req := persisters.ClipRequest{
+		Kind:      event.kind,
+		Channel:   app.config.twitch.channel,
+		UserName:  userName,
+		UserID:    event.userID,
+		Moderator: app.moderator(event.userID),
+		Time:      event.time,
+		Clip:      clip,
+		Messages:  messages,
+		Activity:  activity,
+	}
+
+	persistCtx, cancelPersist := context.WithTimeout(context.Background(), persistTimeout)
+	defer cancelPersist()
 
-	_, err := app.persister.Persist(userName, media, messages)
+	if app.previewPersister != nil {
+		preview := buffers.NewClip(app.previewBuffer.SegmentsAlignedWith(clip.Segments), event.time)
+		defer preview.Release()
+
+		app.persistPreview(persistCtx, req, preview)
+	}
+
+	result, err := app.persister.Persist(persistCtx, req)
 	if err != nil {
 		app.logger.Error("Failed to persist stream", "err", err)
+		return err
 	}
 
-	return err
+	app.logger.Info("Persisted stream", "id", result.ID, "url", result.URL, "bytes", result.Bytes, "duration", result.Duration)
+	return nil
 }
 
-func (app *application) listenToMessages() error {
-	app.messagesBuffer = buffers.NewMessagesBuffer(600)
+// persistPreview persists preview, the clip of req in the preview rendition.
+func (app *application) persistPreview(ctx context.Context, req persisters.ClipRequest, preview *buffers.Clip) {
+	if len(preview.Segments) == 0 {
+		app.logger.Warn("Not persisting preview, no preview video was buffered")
+		return
+	}
 
-	throttledPersist := utils.Throttle(utils.Delay(app.persistStream, 30*time.Second), 60*time.Second)
+	req.Clip = preview
+	result, err := app.previewPersister.Persist(ctx, req)
+	if err != nil {
+		app.logger.Error("Failed to persist preview", "err", err)
+		return
+	}
+
+	app.logger.Info("Persisted preview", "id", result.ID, "url", result.URL, "bytes", result.Bytes, "duration", result.Duration)
+}
+
+// rememberModerator keeps who banned or timed out userID at t, forgetting
+// what is older than moderatorTTL.
+func (app *application) rememberModerator(userID, moderator string, t time.Time) {
+	if userID == "" {
+		return
+	}
+
+	app.moderatorsMu.Lock()
+	defer app.moderatorsMu.Unlock()
+
+	for id, entry := range app.moderators {
+		if time.Since(entry.time) > moderatorTTL {
+			delete(app.moderators, id)
+		}
+	}
+
+	app.moderators[userID] = moderatorEntry{moderator: moderator, time: t}
+}
+
+// moderator returns who banned or timed out userID recently, or "" when it is
+// not known.
+func (app *application) moderator(userID string) string {
+	app.moderatorsMu.Lock()
+	defer app.moderatorsMu.Unlock()
+
+	entry, ok := app.moderators[userID]
+	if !ok || time.Since(entry.time) > moderatorTTL {
+		return ""
+	}
+
+	return entry.moderator
+}
+
+// captureDelay is how long it takes after a chat event for the media buffer to
+// catch up with it, derived from the measured stream latency.
+func (app *application) captureDelay() time.Duration {
+	return captureDelay(app.hlsClient.AverageLatency())
+}
+
+// captureDelay falls back to defaultCaptureDelay until latency was measured.
+func captureDelay(latency time.Duration) time.Duration {
+	if latency <= 0 {
+		return defaultCaptureDelay
+	}
+
+	return latency + captureDelayMargin
+}
+
+func (app *application) listenToMessages() error {
+	// Events during a persist are dropped rather than queued, so every
+	// capture starts right at its event with the pre-roll still buffered
+	throttledPersist := utils.Throttle(app.persistStream, 60*time.Second)
 	app.twitchClient.Join(app.config.twitch.channel)
 
 	app.twitchClient.OnConnect(func() {
@@ -162,24 +581,85 @@ func (app *application) listenToMessages() error {
 
 	app.twitchClient.OnClearChatMessage(func(message twitch.ClearChatMessage) {
 		app.logger.Debug("clear chat message", "message", message.Message)
-		go throttledPersist(message.TargetUsername)
+
+		removal := buffers.MessageRemoval{Action: buffers.RemovalBan, Time: message.Time}
+		if message.BanDuration > 0 {
+			removal.Action = buffers.RemovalTimeout
+			removal.Duration = time.Duration(message.BanDuration) * time.Second
+		}
+
+		// Without a target the whole chat was cleared
+		kind := "clear"
+		if message.TargetUserID != "" {
+			kind = string(removal.Action)
+			app.messagesBuffer.Purge(message.TargetUserID, removal)
+		}
+
+		go throttledPersist(moderationEvent{kind: kind, userID: message.TargetUserID, userName: message.TargetUsername, time: message.Time})
 	})
 
 	app.twitchClient.OnClearMessage(func(message twitch.ClearMessage) {
 		app.logger.Debug("clear message", "message", message.Message)
-		go throttledPersist(message.Login)
+		now := time.Now()
+		app.messagesBuffer.Delete(message.TargetMsgID, buffers.MessageRemoval{Action: buffers.RemovalDelete, Time: now})
+
+		go throttledPersist(moderationEvent{kind: string(buffers.RemovalDelete), userName: message.Login, time: now})
 	})
 
 	app.twitchClient.OnPrivateMessage(func(message twitch.PrivateMessage) {
 		app.logger.Debug("private message", "message", message.Message)
-		messageData := &buffers.MessageData{
-			ID:       message.ID,
-			Time:     message.Time,
-			Message:  message.Message,
-			UserName: message.User.Name,
-		}
+		messageData := newMessageData(message)
 		app.messagesBuffer.Insert(messageData)
+		app.chatActivity.Insert(messageData)
 	})
 
 	return app.twitchClient.Connect()
 }
+
+func newMessageData(message twitch.PrivateMessage) *buffers.MessageData {
+	messageData := &buffers.MessageData{
+		ID:       message.ID,
+		Time:     message.Time,
+		Message:  message.Message,
+		UserName: message.User.Name,
+
+		UserID:        message.User.ID,
+		DisplayName:   message.User.DisplayName,
+		Color:         message.User.Color,
+		Badges:        message.User.Badges,
+		IsBroadcaster: message.User.IsBroadcaster,
+		IsMod:         message.User.IsMod,
+		IsVip:         message.User.IsVip,
+
+		Emotes:       make([]buffers.MessageEmote, 0, len(message.Emotes)),
+		Bits:         message.Bits,
+		Action:       message.Action,
+		FirstMessage: message.FirstMessage,
+		Tags:         message.Tags,
+	}
+
+	for _, emote := range message.Emotes {
+		positions := make([]buffers.EmotePosition, len(emote.Positions))
+		for i, position := range emote.Positions {
+			positions[i] = buffers.EmotePosition{Start: position.Start, End: position.End}
+		}
+
+		messageData.Emotes = append(messageData.Emotes, buffers.MessageEmote{
+			ID:        emote.ID,
+			Name:      emote.Name,
+			Positions: positions,
+		})
+	}
+
+	if message.Reply != nil {
+		messageData.Reply = &buffers.MessageReply{
+			ParentMsgID:       message.Reply.ParentMsgID,
+			ParentUserID:      message.Reply.ParentUserID,
+			ParentUserLogin:   message.Reply.ParentUserLogin,
+			ParentDisplayName: message.Reply.ParentDisplayName,
+			ParentMsgBody:     message.Reply.ParentMsgBody,
+		}
+	}
+
+	return messageData
+}
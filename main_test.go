@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		latency time.Duration
+		delay   time.Duration
+	}{
+		{name: "not measured", latency: 0, delay: 30 * time.Second},
+		{name: "measured", latency: 6 * time.Second, delay: 11 * time.Second},
+		{name: "clock skew", latency: -2 * time.Second, delay: 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.delay, captureDelay(tt.latency))
+		})
+	}
+}
+
+func TestModerator(t *testing.T) {
+	app := &application{moderators: make(map[string]moderatorEntry)}
+
+	app.rememberModerator("1", "mod_user", time.Now())
+	app.rememberModerator("2", "other_mod", time.Now().Add(-moderatorTTL-time.Second))
+
+	assert.Equal(t, "mod_user", app.moderator("1"))
+	// Too long ago to still be about the same ban
+	assert.Equal(t, "", app.moderator("2"))
+	// Deleted messages do not tell who deleted them
+	assert.Equal(t, "", app.moderator(""))
+}
@@ -1,13 +1,12 @@
 package persisters
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"time"
-
-	"go-gryps/buffers"
 )
 
 type LocalPersister struct{}
@@ -16,36 +15,37 @@ func NewLocalPersister() Persister {
 	return &LocalPersister{}
 }
 
-func (p *LocalPersister) Persist(
-	userName string,
-	mediaData []*buffers.MediaData,
-	messagesData []*buffers.MessageData,
-) (string, error) {
-
-	if len(mediaData) == 0 {
-		return "", nil
+func (p *LocalPersister) Persist(ctx context.Context, req ClipRequest) (ClipResult, error) {
+	if len(req.Clip.Segments) == 0 {
+		return ClipResult{}, nil
 	}
 
-	readers := make([]io.Reader, len(mediaData))
-	for i, segment := range mediaData {
-		readers[i] = bytes.NewReader(*segment.Data)
-	}
-	reader := io.MultiReader(readers...)
+	reader := newClipReader(ctx, req.Clip)
 
 	timestamp := time.Now().Format("2006-01-02_150405")
 	path := fmt.Sprintf("%s.ts", timestamp)
 
 	f, err := os.Create(path)
 	if err != nil {
-		return "", err
+		return ClipResult{}, err
 	}
 
 	defer f.Close()
 
 	_, err = io.Copy(f, reader)
 	if err != nil {
-		return "", err
+		return ClipResult{}, err
+	}
+
+	url := path
+	if abs, err := filepath.Abs(path); err == nil {
+		url = "file://" + abs
 	}
 
-	return "", nil
+	return ClipResult{
+		ID:       path,
+		URL:      url,
+		Bytes:    reader.bytes,
+		Duration: req.Clip.Duration,
+	}, nil
 }
@@ -1,11 +1,64 @@
 package persisters
 
-import "go-gryps/buffers"
+import (
+	"context"
+	"io"
+	"time"
+
+	"go-gryps/buffers"
+)
 
 type Persister interface {
-	Persist(
-		userName string,
-		mediaData []*buffers.MediaData,
-		messagesData []*buffers.MessageData,
-	) (string, error)
+	Persist(ctx context.Context, req ClipRequest) (ClipResult, error)
+}
+
+// ClipRequest is a clip of a moderation event along with what is known about
+// the event.
+type ClipRequest struct {
+	// Kind is the kind of event, e.g. ban
+	Kind     string
+	Channel  string
+	UserName string
+	UserID   string
+	// Moderator is who took the action, when known
+	Moderator string
+	// Time is when the event happened, Clip.Offset is where it falls in the
+	// clip
+	Time     time.Time
+	Clip     *buffers.Clip
+	Messages []*buffers.MessageData
+	Activity buffers.ChatActivityStats
+}
+
+// ClipResult is where a clip was persisted.
+type ClipResult struct {
+	ID       string
+	URL      string
+	Bytes    int64
+	Duration time.Duration
+}
+
+// clipReader reads the clip's video until ctx is done, counting the bytes
+// read.
+type clipReader struct {
+	ctx    context.Context
+	reader io.Reader
+	bytes  int64
+}
+
+func newClipReader(ctx context.Context, clip *buffers.Clip) *clipReader {
+	return &clipReader{
+		ctx:    ctx,
+		reader: buffers.SegmentsReader(clip.Segments),
+	}
+}
+
+func (cr *clipReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := cr.reader.Read(p)
+	cr.bytes += int64(n)
+	return n, err
 }
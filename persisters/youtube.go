@@ -1,21 +1,18 @@
 package persisters
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/option"
 	"google.golang.org/api/youtube/v3"
-
-	"go-gryps/buffers"
 )
 
 type YoutubePersister struct {
@@ -56,33 +53,17 @@ func NewYoutubePersister() Persister {
 	}
 }
 
-func (yp *YoutubePersister) Persist(
-	userName string,
-	mediaData []*buffers.MediaData,
-	messagesData []*buffers.MessageData,
-) (string, error) {
-	if len(mediaData) == 0 {
-		return "", nil
-	}
-
-	readers := make([]io.Reader, len(mediaData))
-	for i, segment := range mediaData {
-		readers[i] = bytes.NewReader(*segment.Data)
+func (yp *YoutubePersister) Persist(ctx context.Context, req ClipRequest) (ClipResult, error) {
+	if len(req.Clip.Segments) == 0 {
+		return ClipResult{}, nil
 	}
-	reader := io.MultiReader(readers...)
 
-	var descriptionBuilder strings.Builder
-	if len(messagesData) > 0 {
-		descriptionBuilder.WriteString(fmt.Sprintf("Grypsy:\n\n"))
-	}
-	for _, message := range messagesData {
-		descriptionBuilder.WriteString(fmt.Sprintf("[%s]: %s\n", message.UserName, message.Message))
-	}
+	reader := newClipReader(ctx, req.Clip)
 
 	upload := &youtube.Video{
 		Snippet: &youtube.VideoSnippet{
-			Title:       fmt.Sprintf("Nowy grypsiarz: %s", userName),
-			Description: descriptionBuilder.String(),
+			Title:       youtubeTitle(req),
+			Description: youtubeDescription(req),
 			CategoryId:  "22", // TODO: I have no idea what this is, copied from the docs
 		},
 		Status: &youtube.VideoStatus{
@@ -92,11 +73,72 @@ func (yp *YoutubePersister) Persist(
 	}
 
 	call := yp.service.Videos.Insert([]string{"snippet,status"}, upload)
-	response, err := call.Media(reader).Do()
+	response, err := call.Media(reader).Context(ctx).Do()
 	if err != nil {
-		return "", fmt.Errorf("Failed to uplaod video: %v", err)
+		return ClipResult{}, fmt.Errorf("Failed to uplaod video: %v", err)
 	}
 
 	fmt.Printf("Upload successful! videoID: %s\n", response.Id)
-	return response.Id, nil
+	return ClipResult{
+		ID:       response.Id,
+		URL:      "https://www.youtube.com/watch?v=" + response.Id,
+		Bytes:    reader.bytes,
+		Duration: req.Clip.Duration,
+	}, nil
+}
+
+// youtubeTitle names the video after the kind of event.
+func youtubeTitle(req ClipRequest) string {
+	switch req.Kind {
+	case "timeout":
+		return fmt.Sprintf("Timeout: %s", req.UserName)
+	case "delete":
+		return fmt.Sprintf("Usunięta wiadomość: %s", req.UserName)
+	case "clear":
+		return "Wyczyszczony czat"
+	default:
+		return fmt.Sprintf("Nowy grypsiarz: %s", req.UserName)
+	}
+}
+
+// youtubeDescription describes the event, the chat around it and the user's
+// last messages.
+func youtubeDescription(req ClipRequest) string {
+	var descriptionBuilder strings.Builder
+
+	descriptionBuilder.WriteString(fmt.Sprintf("Kanał: %s\n", req.Channel))
+	descriptionBuilder.WriteString(fmt.Sprintf("Akcja: %s", req.Kind))
+	if req.Moderator != "" {
+		descriptionBuilder.WriteString(fmt.Sprintf(" (moderator: %s)", req.Moderator))
+	}
+	descriptionBuilder.WriteString("\n")
+	descriptionBuilder.WriteString(fmt.Sprintf("Czas: %s, w nagraniu od %s\n", req.Time.UTC().Format("2006-01-02 15:04:05 MST"), req.Clip.Offset.Round(time.Second)))
+
+	activity := req.Activity
+	if activity.Messages > 0 {
+		descriptionBuilder.WriteString(fmt.Sprintf("Czat: %.1f wiad./s (zwykle %.1f), %d osób w %s\n", activity.Rate, activity.Baseline, activity.Chatters, activity.Window))
+		if len(activity.TopEmotes) > 0 {
+			emotes := make([]string, len(activity.TopEmotes))
+			for i, emote := range activity.TopEmotes {
+				emotes[i] = fmt.Sprintf("%s ×%d", emote.Value, emote.Count)
+			}
+			descriptionBuilder.WriteString(fmt.Sprintf("Emotki: %s\n", strings.Join(emotes, ", ")))
+		}
+	}
+
+	if len(req.Messages) > 0 {
+		descriptionBuilder.WriteString("\nGrypsy:\n\n")
+	}
+	for _, message := range req.Messages {
+		descriptionBuilder.WriteString(fmt.Sprintf("[%s]: %s", message.UserName, message.Message))
+		if message.IsRemoved() {
+			descriptionBuilder.WriteString(fmt.Sprintf(" (usunięta: %s)", message.Removal.Action))
+		}
+		descriptionBuilder.WriteString("\n")
+	}
+	if !req.Clip.Complete() {
+		descriptionBuilder.WriteString(fmt.Sprintf("\nBrakuje %s nagrania.\n", req.Clip.MissingDuration()))
+	}
+
+	return descriptionBuilder.String()
 }
@@ -0,0 +1,48 @@
+package persisters
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"go-gryps/buffers"
+)
+
+func TestYoutubeMetadata(t *testing.T) {
+	at := time.Date(2025, 5, 11, 13, 40, 0, 0, time.UTC)
+	clip := buffers.NewClip([]*buffers.MediaData{
+		{SeqId: 1, Duration: 60, ProgramDateTime: at.Add(-time.Minute)},
+		{SeqId: 3, Duration: 20, ProgramDateTime: at.Add(2 * time.Second)},
+	}, at)
+
+	req := ClipRequest{
+		Kind:      "timeout",
+		Channel:   "xqc",
+		UserName:  "cool_user",
+		Moderator: "mod_user",
+		Time:      at,
+		Clip:      clip,
+		Messages: []*buffers.MessageData{
+			{UserName: "cool_user", Message: "KEKW", Removal: &buffers.MessageRemoval{Action: buffers.RemovalTimeout}},
+		},
+		Activity: buffers.ChatActivityStats{
+			Window:    30 * time.Second,
+			Messages:  96,
+			Rate:      3.2,
+			Chatters:  45,
+			Baseline:  1,
+			TopEmotes: []buffers.Frequency{{Value: "KEKW", Count: 40}, {Value: "LUL", Count: 12}},
+		},
+	}
+
+	assert.Equal(t, "Timeout: cool_user", youtubeTitle(req))
+	assert.Equal(t, "Kanał: xqc\n"+
+		"Akcja: timeout (moderator: mod_user)\n"+
+		"Czas: 2025-05-11 13:40:00 UTC, w nagraniu od 1m0s\n"+
+		"Czat: 3.2 wiad./s (zwykle 1.0), 45 osób w 30s\n"+
+		"Emotki: KEKW ×40, LUL ×12\n"+
+		"\nGrypsy:\n\n"+
+		"[cool_user]: KEKW (usunięta: timeout)\n"+
+		"\nBrakuje 2s nagrania.\n", youtubeDescription(req))
+}
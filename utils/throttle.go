@@ -5,25 +5,34 @@ import (
 	"time"
 )
 
+// Throttle calls fn at most once per interval. Calls in between are dropped
+// right away instead of waiting for fn, and a call returning an error does not
+// use up the interval.
 func Throttle[T any](fn func(arg T) error, interval time.Duration) func(arg T) error {
 	var mu sync.Mutex
 	var lastCall time.Time
 
 	return func(arg T) error {
 		mu.Lock()
-		defer mu.Unlock()
-
 		now := time.Now()
-		if now.Sub(lastCall) >= interval {
-			err := fn(arg)
-			if err != nil {
-				return err
-			}
-
-			lastCall = now
+		if now.Sub(lastCall) < interval {
+			mu.Unlock()
 			return nil
 		}
 
-		return nil
+		previous := lastCall
+		lastCall = now
+		mu.Unlock()
+
+		err := fn(arg)
+		if err != nil {
+			mu.Lock()
+			if lastCall.Equal(now) {
+				lastCall = previous
+			}
+			mu.Unlock()
+		}
+
+		return err
 	}
 }
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottleOverlappingCalls(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	calls := make([]int, 0)
+
+	throttled := Throttle(func(arg int) error {
+		mu.Lock()
+		calls = append(calls, arg)
+		mu.Unlock()
+
+		<-release
+		return nil
+	}, time.Minute)
+
+	done := make(chan struct{})
+	go func() {
+		throttled(1)
+		close(done)
+	}()
+
+	// Wait for the first call to be inside fn
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(calls) == 1
+	}, time.Second, time.Millisecond)
+
+	// Dropped without waiting for the first call to finish
+	returned := make(chan struct{})
+	go func() {
+		throttled(2)
+		close(returned)
+	}()
+
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("overlapping call waited for the running one")
+	}
+
+	close(release)
+	<-done
+	assert.Equal(t, []int{1}, calls)
+}
+
+func TestThrottleFailedCall(t *testing.T) {
+	calls := 0
+	throttled := Throttle(func(fail bool) error {
+		calls++
+		if fail {
+			return errors.New("failed")
+		}
+		return nil
+	}, time.Minute)
+
+	assert.Error(t, throttled(true))
+	assert.NoError(t, throttled(false))
+	assert.NoError(t, throttled(false))
+	assert.Equal(t, 2, calls)
+}
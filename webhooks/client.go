@@ -1,13 +1,16 @@
 package webhooks
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -24,6 +27,9 @@ const (
 	messageTypeRevocation   = "revocation"
 
 	hmacPrefix = "sha256="
+
+	// shutdownTimeout bounds waiting for the requests in flight on shutdown
+	shutdownTimeout = 5 * time.Second
 )
 
 type Notification struct {
@@ -36,12 +42,26 @@ type Notification struct {
 	Event json.RawMessage `json:"event"`
 }
 
+// ChannelBan is the event of a channel.ban notification, sent for bans and
+// timeouts alike.
+type ChannelBan struct {
+	UserID             string    `json:"user_id"`
+	UserLogin          string    `json:"user_login"`
+	ModeratorUserID    string    `json:"moderator_user_id"`
+	ModeratorUserLogin string    `json:"moderator_user_login"`
+	Reason             string    `json:"reason"`
+	BannedAt           time.Time `json:"banned_at"`
+	EndsAt             time.Time `json:"ends_at"`
+	IsPermanent        bool      `json:"is_permanent"`
+}
+
 type Client struct {
 	port   string
 	secret string
 
 	onStreamOnline  func()
 	onStreamOffline func()
+	onChannelBan    func(ban ChannelBan)
 }
 
 func New(port int, secret string) *Client {
@@ -88,6 +108,16 @@ func (srv *Client) eventSubHandler(c echo.Context) error {
 			if srv.onStreamOffline != nil {
 				srv.onStreamOffline()
 			}
+		case "channel.ban":
+			var ban ChannelBan
+			if err := json.Unmarshal(notification.Event, &ban); err != nil {
+				c.Logger().Error("Error parsing channel.ban event")
+				return c.NoContent(http.StatusBadRequest)
+			}
+
+			if srv.onChannelBan != nil {
+				srv.onChannelBan(ban)
+			}
 		}
 
 		return c.NoContent(http.StatusNoContent)
@@ -113,15 +143,29 @@ func (src *Client) healthcheckHandler(c echo.Context) error {
 	})
 }
 
-func (srv *Client) ListenAndServe() {
+// ListenAndServe serves the webhooks until ctx is done.
+func (srv *Client) ListenAndServe(ctx context.Context) error {
 	e := echo.New()
 	e.Pre(middleware.RemoveTrailingSlash())
 
 	e.POST("/eventsub", srv.eventSubHandler)
 	e.GET("/healthcheck", srv.healthcheckHandler)
 
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		e.Shutdown(shutdownCtx)
+	}()
+
 	e.Logger.Infof("Example app listening at http://localhost%s", srv.port)
-	e.Logger.Fatal(e.Start(srv.port))
+	err := e.Start(srv.port)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
 }
 
 func (srv *Client) OnStreamOnline(callback func()) {
@@ -132,6 +176,12 @@ func (srv *Client) OnStreamOffline(callback func()) {
 	srv.onStreamOffline = callback
 }
 
+// OnChannelBan is called with every ban or timeout, which unlike the chat
+// tells who the moderator was.
+func (srv *Client) OnChannelBan(callback func(ban ChannelBan)) {
+	srv.onChannelBan = callback
+}
+
 func getHmacMessage(headers http.Header, body []byte) string {
 	return headers.Get(twitchMessageID) +
 		headers.Get(twitchMessageTimestamp) +
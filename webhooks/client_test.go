@@ -5,6 +5,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
@@ -64,3 +65,31 @@ func TestWebhooks(t *testing.T) {
 	}
 
 }
+
+func TestChannelBan(t *testing.T) {
+	secret := "your secret goes here"
+	body := `{"subscription":{"id":"f1c2a387-161a-49f9-a165-0f21d7a4e1c4","status":"enabled","type":"channel.ban","version":"1","condition":{"broadcaster_user_id":"1337"},"transport":{"method":"webhook","callback":"null"},"created_at":"2025-05-11T13:40:02.2895535Z"},"event":{"user_id":"1234","user_login":"cool_user","user_name":"Cool_User","broadcaster_user_id":"1337","broadcaster_user_login":"cooler_user","broadcaster_user_name":"Cooler_User","moderator_user_id":"1339","moderator_user_login":"mod_user","moderator_user_name":"Mod_User","reason":"Offensive language","banned_at":"2025-05-11T13:40:00Z","ends_at":"2025-05-11T13:50:00Z","is_permanent":false}}`
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/eventsub", strings.NewReader(body))
+	req.Header.Set(twitchMessageID, "f1c2a387-161a-49f9-a165-0f21d7a4e1c4")
+	req.Header.Set(twitchMessageTimestamp, "2025-05-11T13:40:02.2895535Z")
+	req.Header.Set(twitchMessageSignature, hmacPrefix+getHmac(secret, getHmacMessage(req.Header, []byte(body))))
+	req.Header.Set(messageType, messageTypeNotification)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	var ban ChannelBan
+	h := New(0, secret)
+	h.OnChannelBan(func(b ChannelBan) {
+		ban = b
+	})
+
+	if assert.NoError(t, h.eventSubHandler(c)) {
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "1234", ban.UserID)
+		assert.Equal(t, "mod_user", ban.ModeratorUserLogin)
+		assert.False(t, ban.IsPermanent)
+		assert.Equal(t, 10*time.Minute, ban.EndsAt.Sub(ban.BannedAt))
+	}
+}